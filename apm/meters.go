@@ -1,6 +1,7 @@
 package apm
 
 import (
+	"github.com/micro/go-micro/v2/config/reader"
 	"github.com/rcrowley/go-metrics"
 	"github.com/rcrowley/go-metrics/exp"
 	"github.com/582033/gin-utils/apm/output"
@@ -8,6 +9,7 @@ import (
 	"github.com/582033/gin-utils/log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,7 +23,7 @@ var keys = sync.Map{}
 func init() {
 	//添加http Handle /debug/metrics
 	http.HandleFunc("/debug/metrics", func(writer http.ResponseWriter, request *http.Request) {
-		if config.Get("apm.enable").Bool(false) {
+		if enabled.Load() {
 			exp.ExpHandler(mRegistry).ServeHTTP(writer, request)
 		} else {
 			writer.WriteHeader(http.StatusOK)
@@ -34,25 +36,62 @@ func init() {
 	//prometheusRegistry := prometheus.NewRegistry()
 	//pClient := output.NewPrometheusProvider(mRegistry, "test", "subsys", prometheusRegistry)
 	es := output.NewElasticSearch(mRegistry)
-	go func() {
-		for range time.Tick(tick) {
-			if config.Get("apm.enable").Bool(false) {
-				metrics.CaptureDebugGCStatsOnce(mRegistry)    //更新gc信息
-				metrics.CaptureRuntimeMemStatsOnce(mRegistry) //更新内存状态信息
-				err := es.UpdateElasticSearchMetricsOnce()    //上报到es
-				if err != nil {
-					log.Error(err)
-				}
-			} else {
-				//关闭apm监控
-				keys.Range(func(key, value interface{}) bool {
-					mRegistry.Unregister(key.(string))
-					keys.Delete(key)
-					return true
-				})
+	//先监听再读取当前值，避免遗漏两者之间的变化
+	if _, err := config.Watch("apm.enable", func(_, v reader.Value) {
+		setEnable(es, v.Bool(false))
+	}); err != nil {
+		log.Error(err)
+	}
+	setEnable(es, config.Get("apm.enable").Bool(false))
+}
+
+var enabled atomic.Bool
+
+var reporter = struct {
+	sync.Mutex
+	stop chan struct{}
+}{}
+
+//setEnable 开启时定时上报，关闭时停止上报并注销所有指标
+func setEnable(es output.ElasticSearch, enable bool) {
+	reporter.Lock()
+	defer reporter.Unlock()
+	enabled.Store(enable)
+	if enable {
+		if reporter.stop == nil {
+			reporter.stop = make(chan struct{})
+			go report(es, reporter.stop)
+		}
+		return
+	}
+	if reporter.stop != nil {
+		close(reporter.stop)
+		reporter.stop = nil
+	}
+	//关闭apm监控
+	keys.Range(func(key, value interface{}) bool {
+		mRegistry.Unregister(key.(string))
+		keys.Delete(key)
+		return true
+	})
+}
+
+func report(es output.ElasticSearch, stop chan struct{}) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			metrics.CaptureDebugGCStatsOnce(mRegistry)    //更新gc信息
+			metrics.CaptureRuntimeMemStatsOnce(mRegistry) //更新内存状态信息
+			err := es.UpdateElasticSearchMetricsOnce()    //上报到es
+			if err != nil {
+				log.Error(err)
 			}
 		}
-	}()
+	}
 }
 
 func GetRegistry() metrics.Registry {
@@ -61,7 +100,7 @@ func GetRegistry() metrics.Registry {
 
 //简单的计数器 可以增加 减少
 func Counter(key, t string) metrics.Counter {
-	if config.Get("apm.enable").Bool(false) {
+	if enabled.Load() {
 		k := "counter." + t + "." + key
 		if _, ok := keys.LoadOrStore(k, true); ok {
 			return mRegistry.Get(k).(metrics.Counter)
@@ -73,7 +112,7 @@ func Counter(key, t string) metrics.Counter {
 
 //自增的计数器,用来度量一系列事件发生的比率 提供了平均速率，以及指数平滑平均速率，以及采样后的1分钟，5分钟，15分钟速率
 func Meter(key, t string) metrics.Meter {
-	if config.Get("apm.enable").Bool(false) {
+	if enabled.Load() {
 		k := "meter." + t + "." + key
 		if _, ok := keys.LoadOrStore(k, true); ok {
 			return mRegistry.Get(k).(metrics.Meter)
@@ -85,7 +124,7 @@ func Meter(key, t string) metrics.Meter {
 
 //用来记录一些对象或者事物的瞬时值
 func Gauges(key, t string) metrics.Gauge {
-	if config.Get("apm.enable").Bool(false) {
+	if enabled.Load() {
 		k := "gauge." + t + "." + key
 		if _, ok := keys.LoadOrStore(k, true); ok {
 			return mRegistry.Get(k).(metrics.Gauge)
@@ -97,7 +136,7 @@ func Gauges(key, t string) metrics.Gauge {
 
 //统计数据的分布情况 比如最小值，最大值，中间值，还有中位数，75百分位, 90百分位, 95百分位, 98百分位, 99百分位, 和 99.9百分位的值
 func Histograms(key, t string) metrics.Histogram {
-	if config.Get("apm.enable").Bool(false) {
+	if enabled.Load() {
 		k := "histogram." + t + "." + key
 		if _, ok := keys.LoadOrStore(k, true); ok {
 			return mRegistry.Get(k).(metrics.Histogram)
@@ -110,7 +149,7 @@ func Histograms(key, t string) metrics.Histogram {
 
 //统计当前请求的速率和处理时间
 func Timer(key, t string) metrics.Timer {
-	if config.Get("apm.enable").Bool(false) {
+	if enabled.Load() {
 		k := "timer." + t + "." + key
 		if _, ok := keys.LoadOrStore(k, true); ok {
 			return mRegistry.Get(k).(metrics.Timer)
@@ -0,0 +1,298 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	stdlog "log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/micro/go-micro/v2/config/reader"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+var timeType = reflect.TypeOf(time.Time{})
+
+// Binding 绑定到配置路径的结构体，配置变化时原子替换，Get 返回的值不要修改
+//
+//	type Server struct {
+//		Addr    string        `config:"addr" default:":8080" validate:"required"`
+//		Timeout time.Duration `config:"timeout" default:"3s" validate:"min=100ms,max=1m"`
+//		Workers int           `config:"workers" default:"4" validate:"min=1,max=64"`
+//		Mode    string        `config:"mode" default:"release" validate:"oneof=debug release"`
+//	}
+//
+//	server, err := config.Bind[Server]("server", config.OnChange(func(old, new *Server) {
+//		...
+//	}))
+//
+// config 为相对 path 的 key，可以用 . 分隔多层，结构体字段带 config tag 时递归绑定
+// time.Duration 的配置值可以是 "3s" 这样的字符串或秒数
+type Binding[T any] struct {
+	path     []string
+	v        atomic.Pointer[T]
+	onChange func(old, new *T)
+	onError  func(err error)
+	mu       sync.Mutex
+	err      error
+	stop     func() error
+}
+
+// BindOption Bind 的可选参数
+type BindOption[T any] func(b *Binding[T])
+
+// OnChange 配置变化并通过校验后回调，参数为替换前后的值
+func OnChange[T any](fn func(old, new *T)) BindOption[T] {
+	return func(b *Binding[T]) {
+		b.onChange = fn
+	}
+}
+
+// OnError 配置变化后解析或校验失败时回调，此时保留原来的值，默认输出到标准错误
+func OnError[T any](fn func(err error)) BindOption[T] {
+	return func(b *Binding[T]) {
+		b.onError = fn
+	}
+}
+
+// Bind 读取 path 下的配置到 T，填充默认值并校验，校验失败时返回包含所有错误的 *ValidationError
+// 之后 path 下的配置变化时重新读取
+func Bind[T any](path string, opts ...BindOption[T]) (*Binding[T], error) {
+	if t := reflect.TypeOf((*T)(nil)).Elem(); t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config bind %s: %s is not a struct", path, t)
+	}
+	b := &Binding[T]{onError: func(err error) {
+		stdlog.Printf("config bind %s: %s", path, err.Error())
+	}}
+	if path != "" {
+		b.path = strings.Split(path, ".")
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	v, err := b.load(data)
+	if err != nil {
+		return nil, err
+	}
+	b.v.Store(v)
+	stop, err := Watch(path, func(_, _ reader.Value) {
+		b.reload()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("config bind %s: %w", path, err)
+	}
+	b.stop = stop
+	return b, nil
+}
+
+// Get 当前的值
+func (b *Binding[T]) Get() *T {
+	return b.v.Load()
+}
+
+// Err 最近一次配置变化的解析或校验错误，已生效时为 nil
+func (b *Binding[T]) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// Stop 不再跟随配置变化
+func (b *Binding[T]) Stop() error {
+	return b.stop()
+}
+
+//reload 重新读取配置，失败时保留原来的值
+//回调在释放锁之后执行，回调中可以调用 Err
+func (b *Binding[T]) reload() {
+	b.mu.Lock()
+	values, err := snapshot()
+	var v, old *T
+	if err == nil {
+		v, err = b.load(values)
+	}
+	b.err = err
+	if err == nil {
+		old = b.v.Swap(v)
+	}
+	b.mu.Unlock()
+	if err != nil {
+		if b.onError != nil {
+			b.onError(err)
+		}
+		return
+	}
+	if b.onChange != nil && !reflect.DeepEqual(old, v) {
+		b.onChange(old, v)
+	}
+}
+
+func (b *Binding[T]) load(values reader.Values) (*T, error) {
+	v := new(T)
+	e := &ValidationError{Path: strings.Join(b.path, ".")}
+	bindStruct(reflect.ValueOf(v).Elem(), values, b.path, e)
+	if len(e.Violations) > 0 {
+		return nil, e
+	}
+	return v, nil
+}
+
+// ValidationError 绑定时所有不合法的配置项
+type ValidationError struct {
+	Path       string
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("config %s has %d invalid values:\n  %s", e.Path, len(e.Violations), strings.Join(e.Violations, "\n  "))
+}
+
+func (e *ValidationError) add(path []string, format string, args ...interface{}) {
+	e.Violations = append(e.Violations, strings.Join(path, ".")+": "+fmt.Sprintf(format, args...))
+}
+
+//bindStruct 按 config tag 读取字段，没有配置时使用 default tag，再按 validate tag 校验
+func bindStruct(v reflect.Value, values reader.Values, prefix []string, e *ValidationError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		item := t.Field(i)
+		key := item.Tag.Get("config")
+		if key == "" || key == "-" || !item.IsExported() {
+			continue
+		}
+		path := append(append([]string{}, prefix...), strings.Split(key, ".")...)
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+			bindStruct(fv, values, path, e)
+			continue
+		}
+		value := values.Get(path...)
+		if raw := value.Bytes(); len(raw) > 0 && string(raw) != "null" {
+			if err := setValue(fv, value); err != nil {
+				e.add(path, "invalid value %s: %s", raw, err.Error())
+				continue
+			}
+		} else if def, ok := item.Tag.Lookup("default"); ok {
+			if err := setDefault(fv, def); err != nil {
+				e.add(path, "invalid default %q: %s", def, err.Error())
+				continue
+			}
+		}
+		if rules := item.Tag.Get("validate"); rules != "" {
+			validate(fv, rules, path, e)
+		}
+	}
+}
+
+//setValue 写入配置中的值
+func setValue(v reflect.Value, value reader.Value) error {
+	if v.Type() != durationType {
+		return value.Scan(v.Addr().Interface())
+	}
+	var x interface{}
+	if err := value.Scan(&x); err != nil {
+		return err
+	}
+	switch d := x.(type) {
+	case string:
+		n, err := time.ParseDuration(d)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case float64:
+		v.SetInt(int64(d * float64(time.Second)))
+	default:
+		return fmt.Errorf("cannot use %T as duration", x)
+	}
+	return nil
+}
+
+//setDefault 写入 default tag 中的值，字符串切片可以用逗号分隔，其他类型按 JSON 解析
+func setDefault(v reflect.Value, def string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(def)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(def)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(def, "["):
+		list := strings.Split(def, ",")
+		s := reflect.MakeSlice(v.Type(), 0, len(list))
+		for _, item := range list {
+			s = reflect.Append(s, reflect.ValueOf(strings.TrimSpace(item)).Convert(v.Type().Elem()))
+		}
+		v.Set(s)
+	default:
+		return json.Unmarshal([]byte(def), v.Addr().Interface())
+	}
+	return nil
+}
+
+//validate 支持 required、min=、max=、oneof=，以逗号分隔
+//min/max 对数字和 time.Duration 比较值，对字符串、切片和 map 比较长度
+func validate(v reflect.Value, rules string, path []string, e *ValidationError) {
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			if v.IsZero() {
+				e.add(path, "is required")
+			}
+		case "min", "max":
+			n, limit, err := measure(v, arg)
+			if err != nil {
+				e.add(path, "rule %s: %s", rule, err.Error())
+			} else if name == "min" && n < limit {
+				e.add(path, "must be at least %s", arg)
+			} else if name == "max" && n > limit {
+				e.add(path, "must be at most %s", arg)
+			}
+		case "oneof":
+			s := fmt.Sprint(v.Interface())
+			found := false
+			for _, option := range strings.Fields(arg) {
+				if s == option {
+					found = true
+					break
+				}
+			}
+			if !found {
+				e.add(path, "%q is not one of [%s]", s, arg)
+			}
+		case "":
+		default:
+			e.add(path, "unknown rule %s", name)
+		}
+	}
+}
+
+//measure 取用于 min/max 比较的值和限制
+func measure(v reflect.Value, arg string) (float64, float64, error) {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(arg)
+		return float64(v.Int()), float64(d), err
+	}
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), limit, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), limit, nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), limit, nil
+	case reflect.String, reflect.Slice, reflect.Map:
+		return float64(v.Len()), limit, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported type %s", v.Type())
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type testServer struct {
+	Addr    string        `config:"addr" default:":8080" validate:"required"`
+	Workers int           `config:"workers" default:"4" validate:"min=1,max=64"`
+	Timeout time.Duration `config:"timeout" default:"3s" validate:"min=100ms"`
+	Mode    string        `config:"mode" default:"release" validate:"oneof=debug release"`
+}
+
+func TestBind(t *testing.T) {
+	loadTestSource(t, `{"bind_test": {"workers": 8, "timeout": "5s"}}`)
+	b, err := Bind[testServer]("bind_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Stop()
+	want := testServer{Addr: ":8080", Workers: 8, Timeout: 5 * time.Second, Mode: "release"}
+	if got := *b.Get(); got != want {
+		t.Fatalf("Get = %+v, want %+v", got, want)
+	}
+}
+
+func TestBindValidation(t *testing.T) {
+	loadTestSource(t, `{"bind_invalid": {"workers": 100, "timeout": "10ms", "mode": "test"}}`)
+	_, err := Bind[testServer]("bind_invalid")
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("Bind err = %v, want *ValidationError", err)
+	}
+	if len(ve.Violations) != 3 {
+		t.Fatalf("Violations = %q, want 3", ve.Violations)
+	}
+	if _, err := Bind[int]("bind_invalid"); err == nil {
+		t.Fatal("Bind non-struct: want error")
+	}
+}
+
+func TestBindReload(t *testing.T) {
+	update := loadTestSource(t, `{"bind_reload": {"workers": 8}}`)
+	type change struct {
+		old, new *testServer
+		err      error
+	}
+	changes := make(chan change, 1)
+	errs := make(chan error, 1)
+	var b *Binding[testServer]
+	b, err := Bind[testServer]("bind_reload",
+		OnChange(func(old, new *testServer) {
+			//回调中调用 Err 不能死锁
+			changes <- change{old: old, new: new, err: b.Err()}
+		}),
+		OnError[testServer](func(err error) {
+			if b.Err() == nil {
+				err = errors.New("Err() is nil in OnError")
+			}
+			errs <- err
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Stop()
+
+	update(`{"bind_reload": {"workers": 16}}`)
+	select {
+	case c := <-changes:
+		if c.old.Workers != 8 || c.new.Workers != 16 || c.err != nil {
+			t.Fatalf("OnChange old = %d, new = %d, Err = %v", c.old.Workers, c.new.Workers, c.err)
+		}
+	case err := <-errs:
+		t.Fatalf("OnError: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnChange not called")
+	}
+	if b.Get().Workers != 16 {
+		t.Fatalf("Workers after reload = %d, want 16", b.Get().Workers)
+	}
+
+	//校验失败时保留原来的值
+	update(`{"bind_reload": {"workers": 100}}`)
+	select {
+	case err := <-errs:
+		var ve *ValidationError
+		if !errors.As(err, &ve) {
+			t.Fatalf("OnError err = %v, want *ValidationError", err)
+		}
+	case c := <-changes:
+		t.Fatalf("OnChange called with invalid value %+v", c.new)
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnError not called")
+	}
+	if b.Get().Workers != 16 || b.Err() == nil {
+		t.Fatalf("after invalid reload Workers = %d, Err = %v", b.Get().Workers, b.Err())
+	}
+}
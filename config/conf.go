@@ -107,7 +107,7 @@ func Get(key string) reader.Value {
 	return data.Get(path...)
 }
 
-//Scan 配置信息解析到结构体
+//Scan 配置信息解析到结构体，v 为结构体指针
 func Scan(v interface{}) error {
-	return data.Scan(&v)
+	return data.Scan(v)
 }
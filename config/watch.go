@@ -0,0 +1,70 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/micro/go-micro/v2/config/reader"
+)
+
+// Watch path 下的配置变化时回调 fn，old 和 new 为变化前后 path 下的值，其他 key 的变化不会回调
+// path 为空时监听全部配置，返回的 stop 用于停止监听
+//
+//	stop, err := config.Watch("log.level", func(old, new reader.Value) {
+//		setLevel(new.Int(0))
+//	})
+func Watch(path string, fn func(old, new reader.Value)) (stop func() error, err error) {
+	var keys []string
+	if path != "" {
+		keys = strings.Split(path, ".")
+	}
+	w, err := data.Options().Loader.Watch(keys...)
+	if err != nil {
+		return nil, err
+	}
+	old := data.Get(keys...)
+	//加载器的 watcher.Stop 先关闭通道再移除 watcher，与配置更新并发时会 panic
+	//这里不调用 Stop，停止后不再读取，加载器对无人读取的 watcher 直接丢弃更新
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		for {
+			if _, err := w.Next(); err != nil {
+				return
+			}
+			select {
+			case <-done:
+				return
+			default:
+			}
+			//监听返回的是 path 下的数据，字符串没有引号无法按 JSON 解析，这里从完整快照中读取
+			values, err := snapshot()
+			if err != nil {
+				continue
+			}
+			v := values.Get(keys...)
+			if bytes.Equal(old.Bytes(), v.Bytes()) {
+				continue
+			}
+			fn(old, v)
+			old = v
+		}
+	}()
+	return func() error {
+		once.Do(func() {
+			close(done)
+		})
+		return nil
+	}, nil
+}
+
+//snapshot 加载器的最新配置，配置变化后 data 由后台协程更新，可能晚于监听回调
+func snapshot() (reader.Values, error) {
+	opts := data.Options()
+	snap, err := opts.Loader.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return opts.Reader.Values(snap.ChangeSet)
+}
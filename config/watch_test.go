@@ -0,0 +1,82 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/config/reader"
+	"github.com/micro/go-micro/v2/config/source"
+	"github.com/micro/go-micro/v2/config/source/memory"
+)
+
+//loadTestSource 加载内存配置，返回的函数用于更新配置
+func loadTestSource(t *testing.T, json string) func(json string) {
+	t.Helper()
+	src := memory.NewSource(memory.WithJSON([]byte(json)))
+	if err := LoadMultiple(src); err != nil {
+		t.Fatal(err)
+	}
+	//加载器在后台协程中监听数据源，监听之前的更新会丢失
+	locker := src.(interface {
+		RLock()
+		RUnlock()
+	})
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		locker.RLock()
+		n := reflect.ValueOf(src).Elem().FieldByName("Watchers").Len()
+		locker.RUnlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("memory source is not watched")
+		}
+	}
+	return func(json string) {
+		src.(interface{ Update(*source.ChangeSet) }).Update(&source.ChangeSet{Data: []byte(json), Format: "json"})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	update := loadTestSource(t, `{"watch_test": {"level": "info"}, "watch_other": 1}`)
+	changes := make(chan string, 4)
+	stop, err := Watch("watch_test.level", func(old, new reader.Value) {
+		changes <- old.String("") + "->" + new.String("")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//加载器的通知缓冲只有 1 个，连续更新可能合并，每次更新后等待回调
+	update(`{"watch_test": {"level": "debug"}, "watch_other": 1}`)
+	select {
+	case c := <-changes:
+		if c != "info->debug" {
+			t.Fatalf("change = %s, want info->debug", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch callback not called")
+	}
+	//其他 key 的变化不回调
+	update(`{"watch_test": {"level": "debug"}, "watch_other": 2}`)
+	select {
+	case c := <-changes:
+		t.Fatalf("callback for other key: %s", c)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	//停止后立即更新配置不能 panic，也不再回调
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	update(`{"watch_test": {"level": "warn"}, "watch_other": 2}`)
+	loadTestSource(t, `{"watch_after_stop": 1}`)
+	select {
+	case c := <-changes:
+		t.Fatalf("callback after stop: %s", c)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -11,6 +11,7 @@ const (
 	BaseContextRequestIDKey = "_base_ctx_key_request_id"
 	BaseContextOperatorKey  = "_base_ctx_key_operator"
 	BaseContextSourceKey    = "_base_ctx_key_source"
+	BaseContextTenantKey    = "_base_ctx_key_tenant"
 )
 
 type Base struct {
@@ -47,6 +48,10 @@ func (c *Base) SetOperator(v string) {
 	c.set(BaseContextOperatorKey, v)
 }
 
+func (c *Base) SetTenant(v string) {
+	c.set(BaseContextTenantKey, v)
+}
+
 func (c *Base) GetRequestID() string {
 	if v, ok := c.get(BaseContextRequestIDKey); ok && v != nil && v.(string) != "" {
 		return v.(string)
@@ -70,6 +75,13 @@ func (c *Base) GetOperator() string {
 	return ""
 }
 
+func (c *Base) GetTenant() string {
+	if v, ok := c.get(BaseContextTenantKey); ok && v != nil && v.(string) != "" {
+		return v.(string)
+	}
+	return ""
+}
+
 func (c *Base) set(key string, value interface{}) {
 	if c.keysMutex == nil {
 		c.keysMutex = &sync.RWMutex{}
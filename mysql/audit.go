@@ -0,0 +1,333 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/582033/gin-utils/ctx"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lann/builder"
+)
+
+const (
+	AuditInsert = "insert"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditRecord 一行数据的变更记录，Before/After 为列名到值的映射，插入时 Before 为空，删除时 After 为空
+type AuditRecord struct {
+	Table     string                 `json:"table"`
+	Action    string                 `json:"action"`
+	PK        map[string]interface{} `json:"pk"`
+	Before    map[string]interface{} `json:"before"`
+	After     map[string]interface{} `json:"after"`
+	Operator  string                 `json:"operator"`
+	RequestID string                 `json:"request_id"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// AuditSink 保存审计记录，runner 为写入数据时的事务，在同一事务中写入时随业务一起提交或回滚
+type AuditSink interface {
+	Write(ctx ctx.BaseContext, runner sq.BaseRunner, records []*AuditRecord) error
+}
+
+// AuditFunc 回调形式的 AuditSink，如写入消息队列
+type AuditFunc func(ctx ctx.BaseContext, runner sq.BaseRunner, records []*AuditRecord) error
+
+func (f AuditFunc) Write(ctx ctx.BaseContext, runner sq.BaseRunner, records []*AuditRecord) error {
+	return f(ctx, runner, records)
+}
+
+// AuditTable 写入审计表，表结构
+//
+//	CREATE TABLE audit_log (
+//		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+//		table_name VARCHAR(64) NOT NULL,
+//		action VARCHAR(16) NOT NULL,
+//		pk VARCHAR(255) NOT NULL,
+//		before_data JSON NULL,
+//		after_data JSON NULL,
+//		operator VARCHAR(64) NOT NULL,
+//		request_id VARCHAR(64) NOT NULL,
+//		created_at DATETIME NOT NULL
+//	)
+type AuditTable string
+
+func (t AuditTable) Write(ctx ctx.BaseContext, runner sq.BaseRunner, records []*AuditRecord) error {
+	b := sq.Insert(string(t)).Columns("table_name", "action", "pk", "before_data", "after_data", "operator", "request_id", "created_at")
+	for _, r := range records {
+		pk, err := json.Marshal(r.PK)
+		if err != nil {
+			return err
+		}
+		before, err := marshalImage(r.Before)
+		if err != nil {
+			return err
+		}
+		after, err := marshalImage(r.After)
+		if err != nil {
+			return err
+		}
+		b = b.Values(r.Table, r.Action, string(pk), before, after, r.Operator, r.RequestID, r.CreatedAt)
+	}
+	_, err := b.RunWith(runner).ExecContext(ctx)
+	return err
+}
+
+func marshalImage(m map[string]interface{}) (interface{}, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+var audit = struct {
+	sync.RWMutex
+	tables map[string]bool
+	sink   AuditSink
+}{tables: make(map[string]bool), sink: AuditTable("audit_log")}
+
+// EnableAudit 对这些表的 Insert/BulkInsert/Update/Delete 记录审计日志
+// runner 为 *DBConn 时自动开启事务，保证审计记录和数据一起提交
+// 开启审计的表不支持 Upsert/BulkUpsert，调用时返回错误
+func EnableAudit(tbls ...Table) {
+	audit.Lock()
+	defer audit.Unlock()
+	for _, tbl := range tbls {
+		tbl, _ = unwrap(tbl)
+		audit.tables[tbl.TableName()] = true
+	}
+}
+
+// SetAuditSink 设置审计记录的保存方式，默认写入 audit_log 表
+func SetAuditSink(sink AuditSink) {
+	audit.Lock()
+	defer audit.Unlock()
+	audit.sink = sink
+}
+
+func audited(tbl Table) bool {
+	audit.RLock()
+	defer audit.RUnlock()
+	return audit.tables[tbl.TableName()]
+}
+
+func auditSink() AuditSink {
+	audit.RLock()
+	defer audit.RUnlock()
+	return audit.sink
+}
+
+//auditTx runner 为 *DBConn 时在事务中执行 fn
+func auditTx(ctx ctx.BaseContext, runner sq.BaseRunner, fn func(r sq.BaseRunner) error) error {
+	if dbConn, ok := runner.(*DBConn); ok {
+		return dbConn.WithTx(ctx, func(tx *Tx) error {
+			return fn(tx)
+		})
+	}
+	return fn(runner)
+}
+
+//newAuditRecord 生成审计记录
+func newAuditRecord(ctx ctx.BaseContext, tbl Table, action string, before, after Row) *AuditRecord {
+	r := &AuditRecord{
+		Table:     tbl.TableName(),
+		Action:    action,
+		Operator:  ctx.GetOperator(),
+		RequestID: ctx.GetRequestID(),
+		CreatedAt: time.Now(),
+	}
+	if before != nil {
+		r.Before = image(before)
+	}
+	if after != nil {
+		r.After = image(after)
+	}
+	src := after
+	if src == nil {
+		src = before
+	}
+	r.PK = make(map[string]interface{})
+	if pks, err := pkFields(tbl); err == nil {
+		v := reflect.Indirect(reflect.ValueOf(src))
+		for _, f := range pks {
+			r.PK[f.Tag] = v.FieldByIndex(f.Index).Interface()
+		}
+	}
+	return r
+}
+
+//image 一行的列值，使用转换器的字段记录转换后的值
+func image(row Row) map[string]interface{} {
+	v := reflect.Indirect(reflect.ValueOf(row))
+	fields := getField(row)
+	m := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		val := f.value(v.FieldByIndex(f.Index))
+		if valuer, ok := val.(driver.Valuer); ok {
+			if dv, err := valuer.Value(); err == nil {
+				val = dv
+			}
+		}
+		if b, ok := val.([]byte); ok {
+			val = string(b)
+		}
+		m[f.Tag] = val
+	}
+	return m
+}
+
+//auditInsert 记录插入的行，需要在自增 ID 回写后调用
+func auditInsert(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, list []Row) error {
+	records := make([]*AuditRecord, 0, len(list))
+	for _, row := range list {
+		records = append(records, newAuditRecord(ctx, tbl, AuditInsert, nil, row))
+	}
+	return auditSink().Write(ctx, runner, records)
+}
+
+//affected 查询 UPDATE/DELETE 将影响的行并加锁
+func affected(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, name string, b interface{}) ([]Row, error) {
+	sb := sq.Select(Field(tbl)...).From(name)
+	//没有条件时为全表，取不到条件时报错，避免审计范围与实际执行的语句不一致
+	if where, ok := builder.Get(b, "WhereParts"); ok {
+		parts, ok := where.([]sq.Sqlizer)
+		if !ok {
+			return nil, fmt.Errorf("audit %s: cannot read where from builder", tbl.TableName())
+		}
+		for _, w := range parts {
+			sb = sb.Where(w)
+		}
+	}
+	if orders, ok := builder.Get(b, "OrderBys"); ok {
+		sb = sb.OrderBy(orders.([]string)...)
+	}
+	if limit, ok := builder.Get(b, "Limit"); ok {
+		n, err := strconv.ParseUint(limit.(string), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		sb = sb.Limit(n)
+	}
+	if dialectOf(runner).Name() != DialectSQLite {
+		sb = sb.Suffix("FOR UPDATE")
+	}
+	return Select(ctx, runner, Unscoped(tbl), func(string) sq.SelectBuilder {
+		return sb
+	})
+}
+
+//reload 按主键重新查询更新后的行
+func reload(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, name string, rows []Row) (map[string]Row, error) {
+	pks, err := pkFields(tbl)
+	if err != nil {
+		return nil, fmt.Errorf("audit update: %w", err)
+	}
+	or := make(sq.Or, 0, len(rows))
+	for _, row := range rows {
+		v := reflect.Indirect(reflect.ValueOf(row))
+		eq := make(sq.Eq, len(pks))
+		for _, f := range pks {
+			eq[f.Tag] = v.FieldByIndex(f.Index).Interface()
+		}
+		or = append(or, eq)
+	}
+	list, err := Select(ctx, runner, Unscoped(tbl), func(string) sq.SelectBuilder {
+		return sq.Select(Field(tbl)...).From(name).Where(or)
+	})
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]Row, len(list))
+	for _, row := range list {
+		m[pkKey(pks, row)] = row
+	}
+	return m, nil
+}
+
+func pkKey(pks []FiledInfo, row Row) string {
+	v := reflect.Indirect(reflect.ValueOf(row))
+	values := make([]interface{}, 0, len(pks))
+	for _, f := range pks {
+		values = append(values, v.FieldByIndex(f.Index).Interface())
+	}
+	return fmt.Sprint(values...)
+}
+
+//auditUpdate 带审计的更新，记录更新前后的行
+func auditUpdate(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, b sq.UpdateBuilder) (count int64, err error) {
+	name, ok := builder.Get(b, "Table")
+	if !ok {
+		return 0, fmt.Errorf("audit update %s: cannot read table from builder", tbl.TableName())
+	}
+	err = auditTx(ctx, runner, func(r sq.BaseRunner) error {
+		before, err := affected(ctx, r, tbl, name.(string), b)
+		if err != nil {
+			return err
+		}
+		res, err := b.RunWith(r).ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		if count, err = res.RowsAffected(); err != nil {
+			return err
+		}
+		if len(before) == 0 {
+			return nil
+		}
+		after, err := reload(ctx, r, tbl, name.(string), before)
+		if err != nil {
+			return err
+		}
+		pks, _ := pkFields(tbl)
+		records := make([]*AuditRecord, 0, len(before))
+		for _, row := range before {
+			if a, ok := after[pkKey(pks, row)]; ok {
+				records = append(records, newAuditRecord(ctx, tbl, AuditUpdate, row, a))
+			}
+		}
+		return auditSink().Write(ctx, r, records)
+	})
+	return
+}
+
+//auditDelete 带审计的删除，记录删除前的行
+func auditDelete(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, b sq.DeleteBuilder) (count int64, err error) {
+	name, ok := builder.Get(b, "From")
+	if !ok {
+		return 0, fmt.Errorf("audit delete %s: cannot read table from builder", tbl.TableName())
+	}
+	err = auditTx(ctx, runner, func(r sq.BaseRunner) error {
+		before, err := affected(ctx, r, tbl, name.(string), b)
+		if err != nil {
+			return err
+		}
+		res, err := b.RunWith(r).ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		if count, err = res.RowsAffected(); err != nil {
+			return err
+		}
+		if len(before) == 0 {
+			return nil
+		}
+		records := make([]*AuditRecord, 0, len(before))
+		for _, row := range before {
+			records = append(records, newAuditRecord(ctx, tbl, AuditDelete, row, nil))
+		}
+		return auditSink().Write(ctx, r, records)
+	})
+	return
+}
@@ -0,0 +1,296 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/582033/gin-utils/ctx"
+	"github.com/582033/gin-utils/log"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	//默认批量大小，无法获取 max_allowed_packet 时使用
+	defaultBatchSize = 100
+	maxBatchSize     = 5000
+	//单条语句的占位符上限
+	maxPlaceholders = 65535
+)
+
+type bulkOptions struct {
+	size        int
+	inTx        bool
+	ignore      bool
+	stopOnError bool
+}
+
+// BulkOption BulkInsertWith 的可选参数
+type BulkOption func(o *bulkOptions)
+
+// BatchSize 每批写入的行数，不设置时按 max_allowed_packet 和行大小估算
+func BatchSize(n int) BulkOption {
+	return func(o *bulkOptions) {
+		o.size = n
+	}
+}
+
+// BulkInTx 所有批次在同一个事务中写入，任一批失败时全部回滚
+func BulkInTx() BulkOption {
+	return func(o *bulkOptions) {
+		o.inTx = true
+	}
+}
+
+// InsertIgnore 使用 INSERT IGNORE，唯一键冲突的行被忽略，此时不回写自增 ID
+// 开启审计的表不支持，写入时返回错误
+func InsertIgnore() BulkOption {
+	return func(o *bulkOptions) {
+		o.ignore = true
+	}
+}
+
+// StopOnError 遇到失败的批次后不再写入后续批次，默认继续写入
+func StopOnError() BulkOption {
+	return func(o *bulkOptions) {
+		o.stopOnError = true
+	}
+}
+
+// BatchError 失败的批次，对应 list[Begin:End]
+type BatchError struct {
+	Begin int
+	End   int
+	Err   error
+}
+
+func (e BatchError) Error() string {
+	return fmt.Sprintf("rows [%d, %d): %s", e.Begin, e.End, e.Err.Error())
+}
+
+// BulkResult 批量写入结果
+type BulkResult struct {
+	//写入的行数，INSERT IGNORE 时不包括被忽略的行，事务回滚时为 0
+	Inserted int64
+	//批次数
+	Batches int
+	//失败的批次，StopOnError 或事务模式下之后的批次不会执行，也不在其中
+	Failed []BatchError
+}
+
+// BulkInsertWith 批量插入，可配置批量大小、事务和 INSERT IGNORE，有失败批次时同时返回结果和错误
+//
+//	res, err := mysql.BulkInsertWith(ctx, db, list, mysql.BatchSize(500), mysql.InsertIgnore())
+func BulkInsertWith(ctx ctx.BaseContext, runner sq.BaseRunner, list []Row, opts ...BulkOption) (*BulkResult, error) {
+	result := &BulkResult{}
+	if len(list) == 0 {
+		return result, nil
+	}
+	o := &bulkOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	size := o.size
+	if size <= 0 {
+		size = batchSize(runner, list)
+	}
+	if n := len(getField(list[0])); n > 0 && size*n > maxPlaceholders {
+		size = maxPlaceholders / n
+	}
+
+	run := func(r sq.BaseRunner) error {
+		for begin := 0; begin < len(list); begin += size {
+			end := begin + size
+			if end > len(list) {
+				end = len(list)
+			}
+			result.Batches++
+			_, c, err := insertBatch(ctx, r, "", o.ignore, list[begin:end])
+			if err != nil {
+				result.Failed = append(result.Failed, BatchError{Begin: begin, End: end, Err: err})
+				if o.stopOnError || o.inTx {
+					return err
+				}
+				continue
+			}
+			result.Inserted += c
+		}
+		return nil
+	}
+
+	if o.inTx {
+		err := WithTx(ctx, runner, func(tx *Tx) error {
+			return run(tx)
+		})
+		if err != nil {
+			result.Inserted = 0
+			return result, fmt.Errorf("bulk insert rolled back: %w", err)
+		}
+		return result, nil
+	}
+	_ = run(runner)
+	if len(result.Failed) > 0 {
+		return result, fmt.Errorf("%d of %d batches failed, first: %w", len(result.Failed), result.Batches, result.Failed[0].Err)
+	}
+	return result, nil
+}
+
+//insertBatch 写入一批，不限制行数，开启审计时在同一事务中记录插入的行
+func insertBatch(ctx ctx.BaseContext, runner sq.BaseRunner, into string, ignore bool, list []Row) (lastID, count int64, err error) {
+	if err = fillTenant(ctx, list); err != nil {
+		return 0, 0, err
+	}
+	defer invalidate(runner, list[0])
+	if !audited(list[0]) {
+		return execInsert(ctx, runner, into, ignore, list)
+	}
+	//INSERT IGNORE 忽略了部分行时无法确定写入的行
+	if ignore {
+		return 0, 0, fmt.Errorf("%s is audited, insert ignore is not supported", list[0].TableName())
+	}
+	err = auditTx(ctx, runner, func(r sq.BaseRunner) error {
+		if lastID, count, err = execInsert(ctx, r, into, ignore, list); err != nil {
+			return err
+		}
+		return auditInsert(ctx, r, list[0], list)
+	})
+	return
+}
+
+func execInsert(ctx ctx.BaseContext, runner sq.BaseRunner, into string, ignore bool, list []Row) (lastID, count int64, err error) {
+	touchCreated(list)
+	b, err := insertBuilder(list, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	if into != "" {
+		b = b.Into(into)
+	}
+	d := dialectOf(runner)
+	if ignore {
+		b = d.InsertIgnore(b)
+	}
+	if auto, ok := findOpt(list[0], OptAuto); ok && d.Returning() {
+		return insertReturning(ctx, runner, b.Suffix("RETURNING "+d.Quote(auto.Tag)), list)
+	}
+	res, err := b.RunWith(runner).ExecContext(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	count, _ = res.RowsAffected()
+	lastID, _ = res.LastInsertId()
+	//忽略了部分行时自增 ID 不连续，无法回写
+	if !ignore || count == int64(len(list)) {
+		setAutoID(list, lastID)
+	}
+	return
+}
+
+//insertReturning 通过 RETURNING 获取每行的自增 ID，lastID 为第一行的 ID，与 MySQL 一致
+func insertReturning(ctx ctx.BaseContext, runner sq.BaseRunner, b sq.InsertBuilder, list []Row) (lastID, count int64, err error) {
+	rows, err := b.RunWith(runner).QueryContext(WithPrimary(ctx))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	count = int64(len(ids))
+	if count == 0 {
+		return 0, 0, nil
+	}
+	//忽略了部分行时无法对应到具体的行
+	if len(ids) == len(list) {
+		setAutoIDs(list, ids)
+	}
+	return ids[0], count, nil
+}
+
+//batchSize 按 max_allowed_packet 的一半和前几行的估算大小计算批量大小
+func batchSize(runner sq.BaseRunner, list []Row) int {
+	var dbConn *DBConn
+	switch r := runner.(type) {
+	case *DBConn:
+		dbConn = r
+	case *Tx:
+		dbConn = r.dbConn
+	default:
+		return defaultBatchSize
+	}
+	if dbConn.Dialect().Name() != DialectMySQL {
+		return defaultBatchSize
+	}
+	packet := dbConn.maxAllowedPacket()
+	if packet <= 0 {
+		return defaultBatchSize
+	}
+	sample := list
+	if len(sample) > 10 {
+		sample = sample[:10]
+	}
+	var total int
+	for _, row := range sample {
+		total += rowSize(row)
+	}
+	per := total / len(sample)
+	if per <= 0 {
+		per = 1
+	}
+	size := int(packet/2) / per
+	if size < 1 {
+		size = 1
+	}
+	if size > maxBatchSize {
+		size = maxBatchSize
+	}
+	return size
+}
+
+//rowSize 估算一行在 SQL 中的字节数
+func rowSize(row Row) int {
+	v := reflect.Indirect(reflect.ValueOf(row))
+	size := 2
+	for _, f := range getField(row) {
+		size += 4
+		fv := reflect.Indirect(v.FieldByIndex(f.Index))
+		switch fv.Kind() {
+		case reflect.String:
+			size += fv.Len() * 2
+		case reflect.Slice, reflect.Map:
+			if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8 {
+				size += fv.Len() * 2
+			} else {
+				//JSON 等转换后的值，按元素数粗略估算
+				size += fv.Len() * 32
+			}
+		case reflect.Struct:
+			size += 32
+		default:
+			size += 20
+		}
+	}
+	return size
+}
+
+//maxAllowedPacket 查询并缓存主库的 max_allowed_packet
+func (dbConn *DBConn) maxAllowedPacket() int64 {
+	dbConn.packetOnce.Do(func() {
+		c, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := dbConn.db.QueryRowContext(c, "SELECT @@max_allowed_packet").Scan(&dbConn.maxPacket); err != nil {
+			log.Warnf("mysql %s get max_allowed_packet error: %s", dbConn.name, err.Error())
+		}
+	})
+	return dbConn.maxPacket
+}
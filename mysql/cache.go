@@ -0,0 +1,256 @@
+package mysql
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/582033/gin-utils/apm"
+	"github.com/582033/gin-utils/ctx"
+	"github.com/582033/gin-utils/log"
+	"github.com/582033/gin-utils/redis"
+
+	sq "github.com/Masterminds/squirrel"
+	rds "github.com/gomodule/redigo/redis"
+)
+
+const cachePrefix = "mysql:cache:"
+
+var queryCache = struct {
+	sync.RWMutex
+	tables map[string]bool
+	//redis 实例的配置 key
+	redis string
+}{tables: make(map[string]bool), redis: "default"}
+
+// EnableCache 允许这些表的查询使用 Cached 缓存，表的 Insert/Update/Delete/Upsert 会使缓存失效
+// 所有写入这些表的服务都需要调用，否则其他服务的写入不会使缓存失效
+// 缓存按库区分，不同库中的同名表互不影响
+func EnableCache(tbls ...Table) {
+	queryCache.Lock()
+	defer queryCache.Unlock()
+	for _, tbl := range tbls {
+		tbl, _ = unwrap(tbl)
+		queryCache.tables[tbl.TableName()] = true
+	}
+}
+
+// SetCacheRedis 设置缓存使用的 redis 实例，默认为 default
+func SetCacheRedis(key string) {
+	queryCache.Lock()
+	defer queryCache.Unlock()
+	queryCache.redis = key
+}
+
+func cacheEnabled(tbl Table) bool {
+	queryCache.RLock()
+	defer queryCache.RUnlock()
+	return queryCache.tables[tbl.TableName()]
+}
+
+//cacheConn 缓存使用的 redis 连接，不可用时为 nil
+func cacheConn() *redis.Connect {
+	queryCache.RLock()
+	key := queryCache.redis
+	queryCache.RUnlock()
+	c, err := redis.Lookup(key)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+//cached 标记查询结果缓存到 redis
+type cached struct {
+	Table
+	ttl time.Duration
+}
+
+// Cached 包装 tbl，Select/SelectOne 的结果按 SQL 和参数缓存 ttl，表需要先通过 EnableCache 开启
+// 事务中和 runner 不是 *DBConn 的查询不使用缓存，redis 不可用时直接查询数据库
+//
+//	mysql.SelectOne(ctx, db, mysql.Cached(&User{}, time.Minute), builder)
+func Cached(tbl Table, ttl time.Duration) Table {
+	return cached{Table: tbl, ttl: ttl}
+}
+
+//cacheTTL 取出 Cached 包装中的 ttl
+func cacheTTL(tbl Table) (time.Duration, bool) {
+	for {
+		switch t := tbl.(type) {
+		case cached:
+			return t.ttl, true
+		case preload:
+			tbl = t.Table
+		case unscoped:
+			tbl = t.Table
+		default:
+			return 0, false
+		}
+	}
+}
+
+//cacheScope 缓存的命名空间，MySQL 为 host:port/db，其他驱动为连接串的摘要
+func (v Conf) cacheScope() string {
+	if v.DSN != "" {
+		h := sha1.Sum([]byte(v.DSN))
+		return v.Driver + ":" + hex.EncodeToString(h[:8])
+	}
+	return fmt.Sprintf("%s:%d/%s", v.Host, v.Port, v.DBName)
+}
+
+//scopeOf runner 所在实例的缓存命名空间，无法判断实例时 ok 为 false
+func scopeOf(runner sq.BaseRunner) (string, bool) {
+	switch r := runner.(type) {
+	case *DBConn:
+		return r.cacheScope, true
+	case *Tx:
+		return r.dbConn.cacheScope, true
+	}
+	return "", false
+}
+
+//generationKey 表的缓存版本，写入时自增，旧版本的缓存不再被读取，等待过期
+func generationKey(scope string, tbl Table) string {
+	return cachePrefix + "gen:" + scope + ":" + tbl.TableName()
+}
+
+//cacheKey 由表的缓存版本、SQL 和参数生成缓存 key
+func cacheKey(conn *redis.Connect, scope string, tbl Table, sb sq.SelectBuilder) (string, error) {
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return "", err
+	}
+	gen, err := rds.Int64(conn.Do("GET", generationKey(scope, tbl)))
+	if err != nil && err != rds.ErrNil {
+		return "", err
+	}
+	h := sha1.New()
+	h.Write([]byte(query))
+	for _, arg := range args {
+		fmt.Fprintf(h, "\x00%T:%v", arg, arg)
+	}
+	return fmt.Sprintf("%s%s:%s:%d:%s", cachePrefix, scope, tbl.TableName(), gen, hex.EncodeToString(h.Sum(nil))), nil
+}
+
+//cachedSelect 先读缓存，未命中时查询并写入缓存
+//只缓存本表的行，关联字段每次查询后加载，避免子表写入后读到旧数据
+func cachedSelect(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, sb sq.SelectBuilder, names []string, ttl time.Duration) ([]Row, error) {
+	if !cacheEnabled(tbl) {
+		return nil, fmt.Errorf("%s cache is not enabled, call mysql.EnableCache first", tbl.TableName())
+	}
+	list, err := cachedRows(ctx, runner, tbl, sb, ttl)
+	if err != nil || len(names) == 0 {
+		return list, err
+	}
+	parents := make([]reflect.Value, 0, len(list))
+	for _, row := range list {
+		parents = append(parents, reflect.ValueOf(row).Elem())
+	}
+	if err := loadRelations(ctx, runner, tbl, parents, names); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+//cachedRows 查询本表的行，redis 不可用或无法判断所在实例时直接查询
+func cachedRows(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, sb sq.SelectBuilder, ttl time.Duration) ([]Row, error) {
+	scope, ok := scopeOf(runner)
+	if !ok {
+		return selectRows(ctx, runner, tbl, sb, nil)
+	}
+	conn := cacheConn()
+	if conn == nil {
+		return selectRows(ctx, runner, tbl, sb, nil)
+	}
+	defer conn.Close()
+	key, err := cacheKey(conn, scope, tbl, sb)
+	if err != nil {
+		log.WithCtx(ctx).Warnf("mysql cache %s error: %s", tbl.TableName(), err.Error())
+		return selectRows(ctx, runner, tbl, sb, nil)
+	}
+	metric := "mysql/cache/" + tbl.TableName()
+	if data, err := rds.Bytes(conn.Do("GET", key)); err == nil {
+		if list, err := decodeRows(tbl, data); err == nil {
+			apm.Counter(metric, "hit").Inc(1)
+			return list, nil
+		}
+	}
+	apm.Counter(metric, "miss").Inc(1)
+	list, err := selectRows(ctx, runner, tbl, sb, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := encodeRows(tbl, list)
+	if err == nil {
+		_, err = conn.Do("SET", key, data, "PX", ttl.Milliseconds())
+	}
+	if err != nil {
+		log.WithCtx(ctx).Warnf("mysql cache %s set error: %s", tbl.TableName(), err.Error())
+	}
+	return list, nil
+}
+
+//encodeRows 以 gob 编码结构体切片
+func encodeRows(tbl Table, list []Row) ([]byte, error) {
+	s := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(getType(tbl))), 0, len(list))
+	for _, row := range list {
+		s = reflect.Append(s, reflect.ValueOf(row))
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).EncodeValue(s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeRows(tbl Table, data []byte) ([]Row, error) {
+	s := reflect.New(reflect.SliceOf(reflect.PtrTo(getType(tbl))))
+	if err := gob.NewDecoder(bytes.NewReader(data)).DecodeValue(s); err != nil {
+		return nil, err
+	}
+	s = s.Elem()
+	list := make([]Row, 0, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		list = append(list, s.Index(i).Interface().(Row))
+	}
+	return list, nil
+}
+
+// Invalidate 使 runner 所在库中表的查询缓存失效，用于 ORM 之外的写入
+func Invalidate(runner sq.BaseRunner, tbls ...Table) {
+	scope, ok := scopeOf(runner)
+	if !ok {
+		return
+	}
+	conn := cacheConn()
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+	for _, tbl := range tbls {
+		tbl, _ = unwrap(tbl)
+		if _, err := conn.Do("INCR", generationKey(scope, tbl)); err != nil {
+			log.Warnf("mysql cache invalidate %s error: %s", tbl.TableName(), err.Error())
+		}
+	}
+}
+
+//invalidate 写入后使缓存失效，事务中在提交后执行
+func invalidate(runner sq.BaseRunner, tbl Table) {
+	if !cacheEnabled(tbl) {
+		return
+	}
+	if tx, ok := runner.(*Tx); ok {
+		tx.afterCommit(func() {
+			Invalidate(tx, tbl)
+		})
+		return
+	}
+	Invalidate(runner, tbl)
+}
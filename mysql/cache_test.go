@@ -0,0 +1,63 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/582033/gin-utils/redis"
+
+	rds "github.com/gomodule/redigo/redis"
+)
+
+func TestCacheScopedByDatabase(t *testing.T) {
+	f, err := redis.RegisterFake("mysql_cache_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	SetCacheRedis("mysql_cache_test")
+	defer SetCacheRedis("default")
+	EnableCache(&testOrder{})
+
+	c := tenantCtx("a")
+	db1, db2 := newTestDB(t), newTestDB(t)
+	if _, err := Insert(c, db1, &testOrder{Title: "db1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Insert(c, db2, &testOrder{Title: "db2"}); err != nil {
+		t.Fatal(err)
+	}
+	tbl := Cached(&testOrder{}, time.Minute)
+	//两个库的 SQL 和参数相同，缓存不能共用
+	if titles := selectTitles(t, c, db1, tbl); len(titles) != 1 || titles[0] != "db1" {
+		t.Fatalf("db1 cached Select = %v", titles)
+	}
+	if titles := selectTitles(t, c, db2, tbl); len(titles) != 1 || titles[0] != "db2" {
+		t.Fatalf("db2 cached Select = %v", titles)
+	}
+
+	conn, err := redis.Lookup("mysql_cache_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	gen := func(db *DBConn) int64 {
+		n, err := rds.Int64(conn.Do("GET", generationKey(db.cacheScope, &testOrder{})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	//db1 的写入只使 db1 的缓存失效
+	gen1, gen2 := gen(db1), gen(db2)
+	if _, err := Insert(c, db1, &testOrder{Title: "db1-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if titles := selectTitles(t, c, db1, tbl); len(titles) != 2 {
+		t.Fatalf("db1 cached Select after Insert = %v", titles)
+	}
+	if gen(db1) != gen1+1 || gen(db2) != gen2 {
+		t.Fatalf("generations after db1 Insert = %d, %d, want %d, %d", gen(db1), gen(db2), gen1+1, gen2)
+	}
+}
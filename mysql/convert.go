@@ -0,0 +1,196 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	//OptJSON 列存储字段的 JSON，如 orm:"ext,json"
+	OptJSON = "json"
+	//OptConv 使用注册的转换器读写，如 orm:"tags,conv=csv"
+	OptConv = "conv"
+)
+
+// Converter 列值转换器，读写时都会使用
+// 枚举等类型也可以直接实现 sql.Scanner 和 driver.Valuer
+type Converter interface {
+	//FromDB 将数据库值 src 写入 dst，dst 为字段的指针，src 可能为 nil
+	FromDB(src interface{}, dst interface{}) error
+	//ToDB 将字段值转换为写入数据库的值
+	ToDB(v interface{}) (driver.Value, error)
+}
+
+var converters = struct {
+	sync.RWMutex
+	m map[string]Converter
+}{m: map[string]Converter{
+	OptJSON: jsonConverter{},
+	"csv":   csvConverter{},
+}}
+
+// RegisterConverter 注册转换器，通过 orm:"column,conv=name" 使用，同名会覆盖
+func RegisterConverter(name string, c Converter) {
+	converters.Lock()
+	defer converters.Unlock()
+	converters.m[name] = c
+}
+
+// converter 字段的转换器，未设置时返回 "", nil
+func (f FiledInfo) converter() (string, Converter) {
+	name := f.Option(OptConv)
+	if name == "" {
+		if !f.Has(OptJSON) {
+			return "", nil
+		}
+		name = OptJSON
+	}
+	converters.RLock()
+	defer converters.RUnlock()
+	return name, converters.m[name]
+}
+
+// scanDest 字段的 Scan 目标
+func (f FiledInfo) scanDest(fv reflect.Value) interface{} {
+	name, c := f.converter()
+	if name == "" {
+		return fv.Addr().Interface()
+	}
+	return &convScanner{name: name, c: c, dst: fv.Addr().Interface()}
+}
+
+// value 字段写入数据库的值
+func (f FiledInfo) value(fv reflect.Value) interface{} {
+	name, c := f.converter()
+	if name == "" {
+		return fv.Interface()
+	}
+	return convValuer{name: name, c: c, v: fv.Interface()}
+}
+
+type convScanner struct {
+	name string
+	c    Converter
+	dst  interface{}
+}
+
+func (s *convScanner) Scan(src interface{}) error {
+	if s.c == nil {
+		return fmt.Errorf("unknown converter %s", s.name)
+	}
+	return s.c.FromDB(src, s.dst)
+}
+
+type convValuer struct {
+	name string
+	c    Converter
+	v    interface{}
+}
+
+func (v convValuer) Value() (driver.Value, error) {
+	if v.c == nil {
+		return nil, fmt.Errorf("unknown converter %s", v.name)
+	}
+	return v.c.ToDB(v.v)
+}
+
+// isNil nil 指针、map、slice
+func isNil(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// setZero 数据库值为 NULL 时将字段置零
+func setZero(dst interface{}) {
+	v := reflect.ValueOf(dst).Elem()
+	v.Set(reflect.Zero(v.Type()))
+}
+
+// jsonConverter 字段与 JSON 互转，nil 写入 NULL
+type jsonConverter struct{}
+
+func (jsonConverter) FromDB(src interface{}, dst interface{}) error {
+	var b []byte
+	switch s := src.(type) {
+	case nil:
+		setZero(dst)
+		return nil
+	case []byte:
+		b = s
+	case string:
+		b = []byte(s)
+	default:
+		return fmt.Errorf("json converter: unsupported type %T", src)
+	}
+	if len(b) == 0 {
+		setZero(dst)
+		return nil
+	}
+	return json.Unmarshal(b, dst)
+}
+
+func (jsonConverter) ToDB(v interface{}) (driver.Value, error) {
+	if isNil(v) {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// csvConverter []string 与逗号分隔字符串互转，可用于 SET 类型，nil 写入 NULL
+type csvConverter struct{}
+
+func (csvConverter) FromDB(src interface{}, dst interface{}) error {
+	p, ok := dst.(*[]string)
+	if !ok {
+		return fmt.Errorf("csv converter: field must be []string, got %T", dst)
+	}
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("csv converter: unsupported type %T", src)
+	}
+	if s == "" {
+		*p = []string{}
+		return nil
+	}
+	*p = strings.Split(s, ",")
+	return nil
+}
+
+func (csvConverter) ToDB(v interface{}) (driver.Value, error) {
+	list, ok := v.([]string)
+	if !ok {
+		return nil, fmt.Errorf("csv converter: field must be []string, got %T", v)
+	}
+	if list == nil {
+		return nil, nil
+	}
+	for _, s := range list {
+		//包含逗号的元素读取时会被拆开
+		if strings.Contains(s, ",") {
+			return nil, fmt.Errorf("csv converter: value %q contains comma", s)
+		}
+	}
+	return strings.Join(list, ","), nil
+}
@@ -0,0 +1,173 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type testExt struct {
+	Raw []byte    `json:"raw"`
+	At  time.Time `json:"at"`
+}
+
+func TestJSONConverterRoundTrip(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.FixedZone("CST", 8*3600))
+	tests := []struct {
+		name string
+		v    interface{}
+		null bool
+	}{
+		{"nil map", map[string]int(nil), true},
+		{"nil pointer", (*testExt)(nil), true},
+		{"nil bytes", []byte(nil), true},
+		{"bytes", []byte{0, 1, 0xff}, false},
+		{"empty bytes", []byte{}, false},
+		{"time", at, false},
+		{"struct", testExt{Raw: []byte("x"), At: at}, false},
+		{"pointer", &testExt{Raw: []byte{}, At: at}, false},
+		{"map", map[string]int{"a": 1}, false},
+	}
+	c := jsonConverter{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := c.ToDB(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (v == nil) != tt.null {
+				t.Fatalf("ToDB = %v, want NULL %v", v, tt.null)
+			}
+			//驱动可能返回 string 或 []byte
+			var src interface{}
+			if v != nil {
+				src = []byte(v.(string))
+			}
+			dst := reflect.New(reflect.TypeOf(tt.v))
+			dst.Elem().Set(reflect.ValueOf(tt.v))
+			if err := c.FromDB(src, dst.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			if !jsonEqual(dst.Elem().Interface(), tt.v) {
+				t.Fatalf("round trip = %#v, want %#v", dst.Elem().Interface(), tt.v)
+			}
+		})
+	}
+}
+
+// jsonEqual time.Time 的时区表示不同，用 Equal 比较
+func jsonEqual(got, want interface{}) bool {
+	switch w := want.(type) {
+	case time.Time:
+		return got.(time.Time).Equal(w)
+	case testExt:
+		g := got.(testExt)
+		return g.At.Equal(w.At) && reflect.DeepEqual(g.Raw, w.Raw)
+	case *testExt:
+		g := got.(*testExt)
+		if g == nil || w == nil {
+			return g == w
+		}
+		return g.At.Equal(w.At) && reflect.DeepEqual(g.Raw, w.Raw)
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func TestCSVConverterRoundTrip(t *testing.T) {
+	c := csvConverter{}
+	for _, list := range [][]string{nil, {}, {"a"}, {"a", "", "b"}} {
+		v, err := c.ToDB(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, src := range []interface{}{v, toBytes(v)} {
+			var got []string
+			if err := c.FromDB(src, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, list) {
+				t.Fatalf("round trip %#v from %T = %#v", list, src, got)
+			}
+		}
+	}
+	if _, err := c.ToDB([]string{"a,b"}); err == nil {
+		t.Fatal("ToDB value with comma: want error")
+	}
+	if err := c.FromDB("a", new(string)); err == nil {
+		t.Fatal("FromDB into string: want error")
+	}
+}
+
+func toBytes(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		return []byte(s)
+	}
+	return v
+}
+
+type testProfile struct {
+	ID   int64              `orm:"id,pk,auto"`
+	Ext  *testExt           `orm:"ext,json"`
+	Meta map[string]string  `orm:"meta,json"`
+	At   time.Time          `orm:"at,json"`
+	Tags []string           `orm:"tags,conv=csv"`
+	Opts map[string]float64 `orm:"opts,conv=json"`
+}
+
+func (*testProfile) TableName() string {
+	return "profiles"
+}
+
+func TestConverterColumns(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`CREATE TABLE profiles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ext TEXT, meta TEXT, at TEXT, tags TEXT, opts TEXT
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	c := tenantCtx("a")
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	rows := []*testProfile{
+		{},
+		{Ext: &testExt{Raw: []byte{0, 0xff}, At: at}, Meta: map[string]string{}, At: at, Tags: []string{"a", "b"}, Opts: map[string]float64{"x": 1.5}},
+	}
+	for _, row := range rows {
+		id, err := Insert(c, db, row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		row.ID = id
+	}
+	var nulls int
+	if err := db.QueryRow("SELECT COUNT(*) FROM profiles WHERE ext IS NULL AND meta IS NULL AND tags IS NULL AND opts IS NULL").Scan(&nulls); err != nil {
+		t.Fatal(err)
+	}
+	if nulls != 1 {
+		t.Fatalf("rows with NULL columns = %d, want 1", nulls)
+	}
+	list, err := Select(c, db, &testProfile{}, func(tblName string) sq.SelectBuilder {
+		return sq.Select("*").From(tblName).OrderBy("id")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != len(rows) {
+		t.Fatalf("Select = %d rows, want %d", len(list), len(rows))
+	}
+	for i, row := range list {
+		got, want := row.(*testProfile), rows[i]
+		if !jsonEqual(got.Ext, want.Ext) {
+			t.Errorf("row %d Ext = %+v, want %+v", i, got.Ext, want.Ext)
+		}
+		if !got.At.Equal(want.At) {
+			t.Errorf("row %d At = %v, want %v", i, got.At, want.At)
+		}
+		got.Ext, got.At, want.Ext, want.At = nil, time.Time{}, nil, time.Time{}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("row %d = %+v, want %+v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Dialect 数据库方言，ORM 通过它生成不同数据库的语句
+// 语句统一使用 ? 占位符，执行前由 DBConn 按 Placeholder 转换
+type Dialect interface {
+	Name() string
+	//Placeholder 占位符格式，PostgreSQL 为 sq.Dollar
+	Placeholder() sq.PlaceholderFormat
+	//Quote 引用标识符
+	Quote(ident string) string
+	//Returning 插入时是否通过 RETURNING 获取自增 ID，否则使用 LastInsertId
+	Returning() bool
+	//InsertIgnore 忽略唯一键冲突的插入
+	InsertIgnore(b sq.InsertBuilder) sq.InsertBuilder
+	//Upsert 唯一键冲突时更新 columns 的语句后缀，conflict 为冲突检测的列
+	//guard 不为空时只在已有行与新行的 guard 列相等时更新，用于租户隔离
+	Upsert(columns, conflict []string, guard string) string
+}
+
+const (
+	DialectMySQL    = "mysql"
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+var dialects = struct {
+	sync.RWMutex
+	m map[string]Dialect
+	//database/sql 驱动名对应的方言
+	drivers map[string]string
+}{
+	m: map[string]Dialect{
+		DialectMySQL:    mysqlDialect{},
+		DialectPostgres: postgresDialect{},
+		DialectSQLite:   sqliteDialect{},
+	},
+	drivers: map[string]string{
+		"mysql":    DialectMySQL,
+		"postgres": DialectPostgres,
+		"pgx":      DialectPostgres,
+		"sqlite3":  DialectSQLite,
+		"sqlite":   DialectSQLite,
+	},
+}
+
+// RegisterDialect 注册方言，drivers 为使用该方言的 database/sql 驱动名
+func RegisterDialect(d Dialect, drivers ...string) {
+	dialects.Lock()
+	defer dialects.Unlock()
+	dialects.m[d.Name()] = d
+	for _, name := range drivers {
+		dialects.drivers[name] = d.Name()
+	}
+}
+
+// GetDialect 按方言名或驱动名获取方言
+func GetDialect(name string) (Dialect, error) {
+	dialects.RLock()
+	defer dialects.RUnlock()
+	if d, ok := dialects.m[name]; ok {
+		return d, nil
+	}
+	if d, ok := dialects.m[dialects.drivers[name]]; ok {
+		return d, nil
+	}
+	return nil, fmt.Errorf("unknown sql dialect %s", name)
+}
+
+// Dialect 实例使用的方言
+func (dbConn *DBConn) Dialect() Dialect {
+	if dbConn.dialect == nil {
+		return mysqlDialect{}
+	}
+	return dbConn.dialect
+}
+
+// Dialect 事务所在实例的方言
+func (tx *Tx) Dialect() Dialect {
+	return tx.dbConn.Dialect()
+}
+
+//dialectOf runner 的方言，无法判断时为 MySQL
+func dialectOf(runner sq.BaseRunner) Dialect {
+	if r, ok := runner.(interface{ Dialect() Dialect }); ok {
+		return r.Dialect()
+	}
+	return mysqlDialect{}
+}
+
+//rebind 将 ? 占位符转换为方言的格式
+func (dbConn *DBConn) rebind(query string) string {
+	if dbConn.dialect == nil {
+		return query
+	}
+	if q, err := dbConn.dialect.Placeholder().ReplacePlaceholders(query); err == nil {
+		return q
+	}
+	return query
+}
+
+// Quoted 按方言引用列名，以逗号连接
+func (f F) Quoted(d Dialect) string {
+	list := make([]string, 0, len(f))
+	for _, c := range f {
+		list = append(list, d.Quote(c))
+	}
+	return strings.Join(list, ",")
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string                      { return DialectMySQL }
+func (mysqlDialect) Placeholder() sq.PlaceholderFormat { return sq.Question }
+func (mysqlDialect) Quote(ident string) string         { return "`" + ident + "`" }
+func (mysqlDialect) Returning() bool                   { return false }
+
+func (mysqlDialect) InsertIgnore(b sq.InsertBuilder) sq.InsertBuilder {
+	return b.Options("IGNORE")
+}
+
+func (d mysqlDialect) Upsert(columns, _ []string, guard string) string {
+	sets := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if guard != "" {
+			sets = append(sets, fmt.Sprintf("%s = IF(%s = VALUES(%s), VALUES(%s), %s)",
+				d.Quote(c), d.Quote(guard), d.Quote(guard), d.Quote(c), d.Quote(c)))
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", d.Quote(c), d.Quote(c)))
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string                      { return DialectPostgres }
+func (postgresDialect) Placeholder() sq.PlaceholderFormat { return sq.Dollar }
+func (postgresDialect) Quote(ident string) string         { return `"` + ident + `"` }
+func (postgresDialect) Returning() bool                   { return true }
+
+func (postgresDialect) InsertIgnore(b sq.InsertBuilder) sq.InsertBuilder {
+	return b.Suffix("ON CONFLICT DO NOTHING")
+}
+
+func (d postgresDialect) Upsert(columns, conflict []string, guard string) string {
+	return onConflict(d, columns, conflict, guard)
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string                      { return DialectSQLite }
+func (sqliteDialect) Placeholder() sq.PlaceholderFormat { return sq.Question }
+func (sqliteDialect) Quote(ident string) string         { return `"` + ident + `"` }
+
+// Returning SQLite 3.35 起支持 RETURNING，多行插入时 LastInsertId 只返回最后一行
+func (sqliteDialect) Returning() bool { return true }
+
+func (sqliteDialect) InsertIgnore(b sq.InsertBuilder) sq.InsertBuilder {
+	return b.Options("OR IGNORE")
+}
+
+func (d sqliteDialect) Upsert(columns, conflict []string, guard string) string {
+	return onConflict(d, columns, conflict, guard)
+}
+
+//onConflict PostgreSQL 和 SQLite 的 ON CONFLICT 语法
+func onConflict(d Dialect, columns, conflict []string, guard string) string {
+	target := make([]string, 0, len(conflict))
+	for _, c := range conflict {
+		target = append(target, d.Quote(c))
+	}
+	sets := make([]string, 0, len(columns))
+	for _, c := range columns {
+		sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", d.Quote(c), d.Quote(c)))
+	}
+	suffix := fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(target, ", "), strings.Join(sets, ", "))
+	if guard != "" {
+		suffix += fmt.Sprintf(" WHERE %s = EXCLUDED.%s", d.Quote(guard), d.Quote(guard))
+	}
+	return suffix
+}
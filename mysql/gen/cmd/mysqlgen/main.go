@@ -0,0 +1,77 @@
+// mysqlgen 按 information_schema 生成实现 mysql.Table 的结构体，每张表一个文件
+//
+//	mysqlgen -config config.json -key default -out internal/model -tables user,order
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/582033/gin-utils/config"
+	"github.com/582033/gin-utils/mysql"
+	"github.com/582033/gin-utils/mysql/gen"
+)
+
+func main() {
+	confFile := flag.String("config", "config.json", "配置文件，读取其中的 mysql 配置")
+	key := flag.String("key", "default", "mysql 配置中的实例名")
+	out := flag.String("out", "model", "输出目录")
+	pkg := flag.String("package", "", "包名，默认为输出目录名")
+	tables := flag.String("tables", "", "逗号分隔的表名，默认全部")
+	jsonTag := flag.Bool("json", true, "是否生成 json tag")
+	flag.Parse()
+
+	if err := config.LoadFile(*confFile); err != nil {
+		exit(err)
+	}
+	dbConn := mysql.DB(*key)
+	if dbConn == nil {
+		exit(fmt.Errorf("mysql config %s not found", *key))
+	}
+	db := dbConn.Original()
+	ctx := context.Background()
+	var schema string
+	if err := db.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&schema); err != nil {
+		exit(err)
+	}
+	var names []string
+	if *tables != "" {
+		names = strings.Split(*tables, ",")
+	}
+	list, err := gen.Load(ctx, db, schema, names...)
+	if err != nil {
+		exit(err)
+	}
+	if len(list) == 0 {
+		exit(fmt.Errorf("no table found in %s", schema))
+	}
+
+	opts := gen.Options{Package: *pkg, JSONTag: *jsonTag}
+	if opts.Package == "" {
+		abs, _ := filepath.Abs(*out)
+		opts.Package = strings.ReplaceAll(filepath.Base(abs), "-", "_")
+	}
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		exit(err)
+	}
+	for _, t := range list {
+		src, err := gen.Generate([]*gen.Table{t}, opts)
+		if err != nil {
+			exit(fmt.Errorf("generate %s: %w", t.Name, err))
+		}
+		file := filepath.Join(*out, t.Name+".go")
+		if err := os.WriteFile(file, src, 0644); err != nil {
+			exit(err)
+		}
+		fmt.Println(file)
+	}
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,276 @@
+package gen
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Column information_schema.COLUMNS 中的一列
+type Column struct {
+	Name     string
+	DataType string
+	//完整类型，如 int(11) unsigned
+	ColumnType string
+	Nullable   bool
+	Auto       bool
+	PK         bool
+	Comment    string
+}
+
+// Table 一张表的结构
+type Table struct {
+	Name    string
+	Comment string
+	Columns []Column
+}
+
+// Options 生成选项
+type Options struct {
+	//包名，默认 model
+	Package string
+	//只生成这些表，为空时生成全部
+	Tables []string
+	//是否生成 json tag
+	JSONTag bool
+}
+
+// Load 从 information_schema 读取 schema 下的表结构
+func Load(ctx context.Context, db *sql.DB, schema string, tables ...string) ([]*Table, error) {
+	filter := ""
+	args := []interface{}{schema}
+	if len(tables) > 0 {
+		filter = " AND TABLE_NAME IN (?" + strings.Repeat(",?", len(tables)-1) + ")"
+		for _, t := range tables {
+			args = append(args, t)
+		}
+	}
+	rows, err := db.QueryContext(ctx, "SELECT TABLE_NAME, TABLE_COMMENT FROM information_schema.TABLES "+
+		"WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE'"+filter+" ORDER BY TABLE_NAME", args...)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Table
+	index := make(map[string]*Table)
+	for rows.Next() {
+		t := &Table{}
+		if err := rows.Scan(&t.Name, &t.Comment); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		list = append(list, t)
+		index[t.Name] = t
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	pks := make(map[string]bool)
+	rows, err = db.QueryContext(ctx, "SELECT TABLE_NAME, COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE "+
+		"WHERE TABLE_SCHEMA = ? AND CONSTRAINT_NAME = 'PRIMARY'"+filter, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var tbl, col string
+		if err := rows.Scan(&tbl, &col); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pks[tbl+"."+col] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT TABLE_NAME, COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, EXTRA, COLUMN_COMMENT "+
+		"FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ?"+filter+" ORDER BY TABLE_NAME, ORDINAL_POSITION", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tbl, nullable, extra string
+		var c Column
+		if err := rows.Scan(&tbl, &c.Name, &c.DataType, &c.ColumnType, &nullable, &extra, &c.Comment); err != nil {
+			return nil, err
+		}
+		t, ok := index[tbl]
+		if !ok {
+			continue
+		}
+		c.DataType = strings.ToLower(c.DataType)
+		c.ColumnType = strings.ToLower(c.ColumnType)
+		c.Nullable = nullable == "YES"
+		c.Auto = strings.Contains(strings.ToLower(extra), "auto_increment")
+		c.PK = pks[tbl+"."+c.Name]
+		t.Columns = append(t.Columns, c)
+	}
+	return list, rows.Err()
+}
+
+// Generate 生成一个 go 文件，包含所有表的结构体和 TableName 方法
+func Generate(tables []*Table, opts Options) ([]byte, error) {
+	if opts.Package == "" {
+		opts.Package = "model"
+	}
+	var body bytes.Buffer
+	imports := make(map[string]bool)
+	for _, t := range tables {
+		writeTable(&body, t, opts, imports)
+	}
+	var b bytes.Buffer
+	b.WriteString("// Code generated by mysqlgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", opts.Package)
+	if len(imports) > 0 {
+		list := make([]string, 0, len(imports))
+		for pkg := range imports {
+			list = append(list, pkg)
+		}
+		sort.Strings(list)
+		b.WriteString("import (\n")
+		for _, pkg := range list {
+			fmt.Fprintf(&b, "\t%q\n", pkg)
+		}
+		b.WriteString(")\n\n")
+	}
+	b.Write(body.Bytes())
+	return format.Source(b.Bytes())
+}
+
+func writeTable(b *bytes.Buffer, t *Table, opts Options, imports map[string]bool) {
+	name := CamelCase(t.Name)
+	if t.Comment != "" {
+		fmt.Fprintf(b, "// %s %s\n", name, oneLine(t.Comment))
+	}
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	for _, c := range t.Columns {
+		goType, pkg := GoType(c)
+		if pkg != "" {
+			imports[pkg] = true
+		}
+		tag := c.Name
+		if c.PK {
+			tag += ",pk"
+		}
+		if c.Auto {
+			tag += ",auto"
+		}
+		tags := fmt.Sprintf("orm:%q", tag)
+		if opts.JSONTag {
+			tags += fmt.Sprintf(" json:%q", c.Name)
+		}
+		fmt.Fprintf(b, "\t%s %s `%s`", fieldName(c.Name), goType, tags)
+		if c.Comment != "" {
+			fmt.Fprintf(b, " // %s", oneLine(c.Comment))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n\n")
+	fmt.Fprintf(b, "func (*%s) TableName() string {\n\treturn %q\n}\n\n", name, t.Name)
+}
+
+//fieldName 列对应的字段名，与生成的 TableName 方法重名时加 Col 后缀
+func fieldName(column string) string {
+	name := CamelCase(column)
+	if name == "TableName" {
+		name += "Col"
+	}
+	return name
+}
+
+// GoType 列对应的 go 类型和需要导入的包，可为 NULL 的列使用 sql.Null* 类型，bigint unsigned 使用 *uint64
+func GoType(c Column) (string, string) {
+	unsigned := strings.Contains(c.ColumnType, "unsigned")
+	var typ, null string
+	switch c.DataType {
+	case "tinyint":
+		if c.ColumnType == "tinyint(1)" {
+			typ, null = "bool", "sql.NullBool"
+		} else if unsigned {
+			typ, null = "uint8", "sql.NullInt16"
+		} else {
+			typ, null = "int8", "sql.NullInt16"
+		}
+	case "smallint", "year":
+		if unsigned {
+			typ, null = "uint16", "sql.NullInt32"
+		} else {
+			typ, null = "int16", "sql.NullInt16"
+		}
+	case "mediumint", "int", "integer":
+		if unsigned {
+			typ, null = "uint32", "sql.NullInt64"
+		} else {
+			typ, null = "int32", "sql.NullInt32"
+		}
+	case "bigint":
+		if unsigned {
+			//sql.NullInt64 存不下超过 int64 的值
+			typ, null = "uint64", "*uint64"
+		} else {
+			typ, null = "int64", "sql.NullInt64"
+		}
+	case "float":
+		typ, null = "float32", "sql.NullFloat64"
+	case "double", "real":
+		typ, null = "float64", "sql.NullFloat64"
+	case "decimal", "numeric":
+		//定点数转为浮点数会丢失精度，按字符串读取
+		typ, null = "string", "sql.NullString"
+	case "date", "datetime", "timestamp":
+		if c.Nullable {
+			return "sql.NullTime", "database/sql"
+		}
+		return "time.Time", "time"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "bit", "geometry":
+		return "[]byte", ""
+	default:
+		//char、varchar、text、enum、set、json、time
+		typ, null = "string", "sql.NullString"
+	}
+	if c.Nullable {
+		if strings.HasPrefix(null, "*") {
+			return null, ""
+		}
+		return null, "database/sql"
+	}
+	return typ, ""
+}
+
+// CamelCase 下划线命名转为驼峰，常见缩写大写，如 user_id => UserID
+func CamelCase(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if upper := strings.ToUpper(part); initialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		r := []rune(part)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	s := b.String()
+	if s == "" || unicode.IsDigit([]rune(s)[0]) {
+		s = "T" + s
+	}
+	return s
+}
+
+var initialisms = map[string]bool{
+	"ID": true, "URL": true, "URI": true, "IP": true, "UUID": true, "API": true,
+	"HTTP": true, "JSON": true, "SQL": true, "UID": true, "UI": true,
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
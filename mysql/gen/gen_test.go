@@ -0,0 +1,56 @@
+package gen
+
+import "testing"
+
+func TestGoType(t *testing.T) {
+	tests := []struct {
+		dataType, columnType string
+		nullable             bool
+		typ, pkg             string
+	}{
+		{"tinyint", "tinyint(1)", false, "bool", ""},
+		{"tinyint", "tinyint(1)", true, "sql.NullBool", "database/sql"},
+		{"tinyint", "tinyint(4)", false, "int8", ""},
+		{"tinyint", "tinyint(3) unsigned", false, "uint8", ""},
+		{"tinyint", "tinyint(3) unsigned", true, "sql.NullInt16", "database/sql"},
+		{"smallint", "smallint(5) unsigned", false, "uint16", ""},
+		{"smallint", "smallint(6)", true, "sql.NullInt16", "database/sql"},
+		{"int", "int(10) unsigned", false, "uint32", ""},
+		{"int", "int(10) unsigned", true, "sql.NullInt64", "database/sql"},
+		{"int", "int(11)", true, "sql.NullInt32", "database/sql"},
+		{"bigint", "bigint(20)", false, "int64", ""},
+		{"bigint", "bigint(20)", true, "sql.NullInt64", "database/sql"},
+		{"bigint", "bigint(20) unsigned", false, "uint64", ""},
+		{"bigint", "bigint(20) unsigned", true, "*uint64", ""},
+		{"float", "float", false, "float32", ""},
+		{"double", "double", true, "sql.NullFloat64", "database/sql"},
+		{"decimal", "decimal(10,2)", false, "string", ""},
+		{"decimal", "decimal(10,2) unsigned", true, "sql.NullString", "database/sql"},
+		{"datetime", "datetime", false, "time.Time", "time"},
+		{"timestamp", "timestamp", true, "sql.NullTime", "database/sql"},
+		{"varchar", "varchar(64)", false, "string", ""},
+		{"json", "json", true, "sql.NullString", "database/sql"},
+		{"blob", "blob", true, "[]byte", ""},
+		{"varbinary", "varbinary(16)", false, "[]byte", ""},
+	}
+	for _, tt := range tests {
+		typ, pkg := GoType(Column{DataType: tt.dataType, ColumnType: tt.columnType, Nullable: tt.nullable})
+		if typ != tt.typ || pkg != tt.pkg {
+			t.Errorf("GoType(%s, nullable=%v) = %s, %q, want %s, %q", tt.columnType, tt.nullable, typ, pkg, tt.typ, tt.pkg)
+		}
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	tests := map[string]string{
+		"user_id":    "UserID",
+		"created_at": "CreatedAt",
+		"api_url":    "APIURL",
+		"name":       "Name",
+	}
+	for name, want := range tests {
+		if got := CamelCase(name); got != want {
+			t.Errorf("CamelCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/582033/gin-utils/apm"
+	ctx2 "github.com/582033/gin-utils/ctx"
+	"github.com/582033/gin-utils/log"
+)
+
+// QueryEvent 一次 SQL 执行的信息
+type QueryEvent struct {
+	//实例名
+	Instance string
+	//调用的方法，如 DB.ExecContext、TX.QueryContext
+	Method string
+	Query  string
+	Args   []interface{}
+	InTx   bool
+	Start  time.Time
+	//以下字段在 After 中可用
+	Duration     time.Duration
+	RowsAffected int64
+	Err          error
+
+	conn        *DBConn
+	db          *sql.DB
+	fingerprint string
+}
+
+// Fingerprint 归一化后的 SQL
+func (e *QueryEvent) Fingerprint() string {
+	if e.fingerprint == "" {
+		e.fingerprint = Fingerprint(e.Query)
+	}
+	return e.fingerprint
+}
+
+// Hook SQL 执行钩子，Before 返回的 context 会传给驱动和 After，可用于埋点、链路追踪
+// After 按注册顺序的逆序执行
+type Hook interface {
+	Before(ctx context.Context, e *QueryEvent) context.Context
+	After(ctx context.Context, e *QueryEvent)
+}
+
+// AfterFunc 只关心执行结果的钩子
+type AfterFunc func(ctx context.Context, e *QueryEvent)
+
+func (f AfterFunc) Before(ctx context.Context, _ *QueryEvent) context.Context {
+	return ctx
+}
+
+func (f AfterFunc) After(ctx context.Context, e *QueryEvent) {
+	f(ctx, e)
+}
+
+// LogHook 以 debug 级别记录每条 SQL
+type LogHook struct{}
+
+func (LogHook) Before(c context.Context, _ *QueryEvent) context.Context {
+	return c
+}
+
+func (LogHook) After(c context.Context, e *QueryEvent) {
+	log.Debugf("[%+v] %s SQL: %s, args: %+v, affected: %v: %s",
+		c.Value(ctx2.BaseContextRequestIDKey), e.Method, e.Query, e.Args, e.RowsAffected, e.Duration)
+}
+
+// MetricsHook 按实例和 SQL 指纹统计耗时和错误数
+type MetricsHook struct{}
+
+func (MetricsHook) Before(c context.Context, _ *QueryEvent) context.Context {
+	return c
+}
+
+func (MetricsHook) After(_ context.Context, e *QueryEvent) {
+	key := "mysql/" + e.Instance + "/" + e.Fingerprint()
+	apm.Histograms(key, "execTimeUs").Update(e.Duration.Microseconds())
+	if e.Err != nil && e.Err != sql.ErrNoRows {
+		apm.Counter(key, "error").Inc(1)
+	}
+}
+
+//全局钩子，默认开启 debug 日志、按指纹统计和慢查询日志
+var hooks = struct {
+	sync.RWMutex
+	list []Hook
+}{list: []Hook{LogHook{}, MetricsHook{}, SlowLogHook{}}}
+
+// AddHook 注册全局钩子，对所有实例生效
+func AddHook(h ...Hook) {
+	hooks.Lock()
+	defer hooks.Unlock()
+	hooks.list = append(append([]Hook{}, hooks.list...), h...)
+}
+
+// SetHooks 替换全局钩子，可用于关闭默认的日志、统计
+func SetHooks(h ...Hook) {
+	hooks.Lock()
+	defer hooks.Unlock()
+	hooks.list = append([]Hook{}, h...)
+}
+
+// AddHook 注册只对当前实例生效的钩子，在全局钩子之后执行
+func (dbConn *DBConn) AddHook(h ...Hook) {
+	dbConn.hookMu.Lock()
+	defer dbConn.hookMu.Unlock()
+	dbConn.hooks = append(append([]Hook{}, dbConn.hooks...), h...)
+}
+
+// Name 实例名
+func (dbConn *DBConn) Name() string {
+	return dbConn.name
+}
+
+func (dbConn *DBConn) allHooks() []Hook {
+	hooks.RLock()
+	list := hooks.list
+	hooks.RUnlock()
+	dbConn.hookMu.RLock()
+	own := dbConn.hooks
+	dbConn.hookMu.RUnlock()
+	if len(own) == 0 {
+		return list
+	}
+	return append(append(make([]Hook, 0, len(list)+len(own)), list...), own...)
+}
+
+// before 执行 SQL 前调用钩子，c 为 nil 时使用 context.Background()
+func (dbConn *DBConn) before(c context.Context, method string, inTx bool, db *sql.DB, query string, args []interface{}) (context.Context, *QueryEvent) {
+	if c == nil {
+		c = context.Background()
+	}
+	e := &QueryEvent{
+		Instance: dbConn.name,
+		Method:   method,
+		Query:    query,
+		Args:     args,
+		InTx:     inTx,
+		Start:    time.Now(),
+		conn:     dbConn,
+		db:       db,
+	}
+	for _, h := range dbConn.allHooks() {
+		c = h.Before(c, e)
+	}
+	return c, e
+}
+
+// after 执行 SQL 后调用钩子
+func (dbConn *DBConn) after(c context.Context, e *QueryEvent, res sql.Result, err error) {
+	e.Duration = time.Since(e.Start)
+	e.Err = err
+	if res != nil {
+		e.RowsAffected, _ = res.RowsAffected()
+	}
+	list := dbConn.allHooks()
+	for i := len(list) - 1; i >= 0; i-- {
+		list[i].After(c, e)
+	}
+}
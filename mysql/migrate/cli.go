@@ -0,0 +1,82 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+const usage = `usage:
+  up [N]         执行未执行的迁移，N 为最多执行的个数，默认全部
+  down [N]       回滚最近执行的 N 个迁移，默认 1
+  status         查看迁移状态
+  create NAME    在 dir 下创建新版本的 up/down 文件`
+
+// Command 执行迁移命令，可嵌入服务自身的命令行，dir 为 create 命令写入的目录
+//
+//	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+//		err := migrate.Command(ctx, migrate.New(db, os.DirFS("migrations")), "migrations", os.Args[2:], os.Stdout)
+//	}
+func Command(ctx context.Context, m *Migrator, dir string, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", usage)
+	}
+	switch args[0] {
+	case "up", "down":
+		n := 0
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n <= 0 {
+				return fmt.Errorf("invalid N: %s", args[1])
+			}
+		}
+		var done []*Migration
+		var err error
+		if args[0] == "up" {
+			done, err = m.Up(ctx, n)
+		} else {
+			done, err = m.Down(ctx, n)
+		}
+		for _, mig := range done {
+			fmt.Fprintf(out, "%s %d_%s\n", args[0], mig.Version, mig.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(out, "no change")
+		}
+		return err
+	case "status":
+		list, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range list {
+			status, at := "pending", ""
+			if s.Applied {
+				status, at = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				status += " (modified)"
+			}
+			if s.Missing {
+				status += " (missing)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, status, at)
+		}
+		return w.Flush()
+	case "create":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: create NAME")
+		}
+		up, down, err := Create(dir, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "created %s\ncreated %s\n", up, down)
+		return nil
+	}
+	return fmt.Errorf("unknown command %s\n%s", args[0], usage)
+}
@@ -0,0 +1,69 @@
+// migrate 数据库迁移命令
+//
+//	migrate -dsn 'user:pass@tcp(127.0.0.1:3306)/db' -dir migrations up
+//	migrate -dir migrations create add_user_email
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/582033/gin-utils/mysql/migrate"
+
+	_ "github.com/go-sql-driver/mysql" // init mysql
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run 执行命令并返回退出码，deferred 的清理在退出前执行
+func run() int {
+	dsn := flag.String("dsn", os.Getenv("MYSQL_DSN"), "mysql dsn, 默认读取环境变量 MYSQL_DSN")
+	dir := flag.String("dir", "migrations", "迁移文件目录")
+	table := flag.String("table", "schema_migrations", "记录版本的表名")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] up [N] | down [N] | status | create NAME\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return 2
+	}
+
+	var m *migrate.Migrator
+	if flag.Arg(0) != "create" {
+		if *dsn == "" {
+			fmt.Fprintln(os.Stderr, "dsn is empty")
+			return 2
+		}
+		db, err := sql.Open("mysql", withParseTime(*dsn))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer db.Close()
+		m = migrate.New(db, os.DirFS(*dir), migrate.WithTable(*table))
+	}
+	if err := migrate.Command(context.Background(), m, *dir, flag.Args(), os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// withParseTime 版本表的 applied_at 需要解析为 time.Time
+func withParseTime(dsn string) string {
+	if strings.Contains(dsn, "parseTime=") {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&parseTime=true"
+	}
+	return dsn + "?parseTime=true"
+}
@@ -0,0 +1,278 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/582033/gin-utils/log"
+)
+
+const (
+	defaultTable       = "schema_migrations"
+	defaultLockTimeout = 60 * time.Second
+)
+
+// Migrator 迁移执行器，执行期间持有 GET_LOCK 锁，多个实例同时启动时串行执行
+type Migrator struct {
+	db          *sql.DB
+	fsys        fs.FS
+	table       string
+	lockName    string
+	lockTimeout time.Duration
+}
+
+// Option Migrator 选项
+type Option func(m *Migrator)
+
+// WithTable 记录版本的表名，默认 schema_migrations
+func WithTable(table string) Option {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// WithLockName GET_LOCK 的锁名，默认 <库名>.<表名>
+func WithLockName(name string) Option {
+	return func(m *Migrator) {
+		m.lockName = name
+	}
+}
+
+// WithLockTimeout 等待锁的超时时间，默认 60s
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(m *Migrator) {
+		m.lockTimeout = timeout
+	}
+}
+
+// New 创建 Migrator，db 可以使用 mysql.DB(key).Original()
+//
+//	//go:embed migrations/*.sql
+//	var files embed.FS
+//	sub, _ := fs.Sub(files, "migrations")
+//	err := migrate.New(mysql.Default().Original(), sub).Up(context.Background(), 0)
+func New(db *sql.DB, fsys fs.FS, opts ...Option) *Migrator {
+	m := &Migrator{db: db, fsys: fsys, table: defaultTable, lockTimeout: defaultLockTimeout}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Status 一个版本的执行状态
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	//已执行但文件被修改
+	Modified bool
+	//已执行但文件不存在
+	Missing bool
+}
+
+type applied struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Up 按版本号执行未执行的迁移，n <= 0 时执行全部，返回本次执行的迁移
+func (m *Migrator) Up(ctx context.Context, n int) (done []*Migration, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		list, history, err := m.load(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range list {
+			if a, ok := history[mig.Version]; ok {
+				if a.checksum != mig.Checksum {
+					return fmt.Errorf("migration %d_%s has been modified after applied", mig.Version, mig.Name)
+				}
+				continue
+			}
+			if n > 0 && len(done) >= n {
+				break
+			}
+			log.Infof("migrate up %d_%s", mig.Version, mig.Name)
+			if err := m.exec(ctx, conn, mig.Up); err != nil {
+				return fmt.Errorf("migrate up %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			_, err := conn.ExecContext(ctx, fmt.Sprintf("INSERT INTO `%s` (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)", m.table),
+				mig.Version, mig.Name, mig.Checksum, time.Now())
+			if err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return
+}
+
+// Down 按版本号倒序回滚最近执行的 n 个迁移，n <= 0 时回滚 1 个
+// 要回滚的版本文件不存在或没有 down 语句时报错，不会跳过
+func (m *Migrator) Down(ctx context.Context, n int) (done []*Migration, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		list, history, err := m.load(ctx, conn)
+		if err != nil {
+			return err
+		}
+		plan, err := downPlan(list, history, n)
+		if err != nil {
+			return err
+		}
+		for _, mig := range plan {
+			log.Infof("migrate down %d_%s", mig.Version, mig.Name)
+			if err := m.exec(ctx, conn, mig.Down); err != nil {
+				return fmt.Errorf("migrate down %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM `%s` WHERE version = ?", m.table), mig.Version); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return
+}
+
+// downPlan 按版本号倒序取最近执行的 n 个迁移
+func downPlan(list []*Migration, history map[int64]applied, n int) ([]*Migration, error) {
+	if n <= 0 {
+		n = 1
+	}
+	versions := make([]int64, 0, len(history))
+	for v := range history {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] > versions[j]
+	})
+	byVersion := make(map[int64]*Migration, len(list))
+	for _, mig := range list {
+		byVersion[mig.Version] = mig
+	}
+	var plan []*Migration
+	for _, v := range versions {
+		if len(plan) >= n {
+			break
+		}
+		mig, ok := byVersion[v]
+		if !ok {
+			return nil, fmt.Errorf("migration %d_%s is applied but its files are missing", v, history[v].name)
+		}
+		if len(split(mig.Down)) == 0 {
+			return nil, fmt.Errorf("migration %d_%s has no down statements", mig.Version, mig.Name)
+		}
+		plan = append(plan, mig)
+	}
+	return plan, nil
+}
+
+// Status 所有版本的执行状态，包括已执行但文件已删除的版本
+func (m *Migrator) Status(ctx context.Context) (list []Status, err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	migrations, history, err := m.load(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int64]bool, len(migrations))
+	for _, mig := range migrations {
+		seen[mig.Version] = true
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := history[mig.Version]; ok {
+			s.Applied, s.AppliedAt, s.Modified = true, a.appliedAt, a.checksum != mig.Checksum
+		}
+		list = append(list, s)
+	}
+	for version, a := range history {
+		if !seen[version] {
+			list = append(list, Status{Version: version, Name: a.name, Applied: true, AppliedAt: a.appliedAt, Missing: true})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list, nil
+}
+
+// load 读取迁移文件和已执行记录，版本表不存在时创建
+func (m *Migrator) load(ctx context.Context, conn *sql.Conn) ([]*Migration, map[int64]applied, error) {
+	list, err := Load(m.fsys)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"`version` BIGINT NOT NULL PRIMARY KEY, "+
+		"`name` VARCHAR(255) NOT NULL, "+
+		"`checksum` CHAR(64) NOT NULL, "+
+		"`applied_at` DATETIME NOT NULL"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", m.table))
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version, name, checksum, applied_at FROM `%s`", m.table))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	history := make(map[int64]applied)
+	for rows.Next() {
+		var version int64
+		var a applied
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, nil, err
+		}
+		history[version] = a
+	}
+	return list, history, rows.Err()
+}
+
+// exec 逐条执行脚本中的语句，DDL 会隐式提交，失败时需要人工处理已执行的部分
+func (m *Migrator) exec(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, stmt := range split(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withLock 在同一个连接上获取 GET_LOCK 后执行 fn
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	name := m.lockName
+	if name == "" {
+		var db sql.NullString
+		if err := conn.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&db); err != nil {
+			return err
+		}
+		name = db.String + "." + m.table
+	}
+	var ok sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int(m.lockTimeout.Seconds())).Scan(&ok); err != nil {
+		return err
+	}
+	if ok.Int64 != 1 {
+		return fmt.Errorf("acquire migration lock %s timeout", name)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name); err != nil {
+			log.Warnf("release migration lock %s error: %s", name, err.Error())
+		}
+	}()
+	return fn(conn)
+}
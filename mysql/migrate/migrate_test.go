@@ -0,0 +1,42 @@
+package migrate
+
+import (
+	"testing"
+)
+
+func TestDownPlan(t *testing.T) {
+	list := []*Migration{
+		{Version: 1, Name: "create_user", Down: "DROP TABLE user;"},
+		{Version: 2, Name: "add_email", Down: "ALTER TABLE user DROP email;"},
+		{Version: 3, Name: "add_index", Down: "-- 0003_add_index created at now\n"},
+		{Version: 4, Name: "pending", Down: "DROP TABLE pending;"},
+	}
+	history := map[int64]applied{1: {name: "create_user"}, 2: {name: "add_email"}}
+
+	plan, err := downPlan(list, history, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 || plan[0].Version != 2 {
+		t.Fatalf("downPlan n=0 = %+v, want version 2", plan)
+	}
+	plan, err = downPlan(list, history, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 2 || plan[0].Version != 2 || plan[1].Version != 1 {
+		t.Fatalf("downPlan n=5 = %+v, want versions 2, 1", plan)
+	}
+
+	//down 文件只有注释时报错，不跳过
+	history[3] = applied{name: "add_index"}
+	if _, err := downPlan(list, history, 1); err == nil {
+		t.Fatal("downPlan with empty down file: want error")
+	}
+	//已执行但文件已删除的版本报错，不回滚更早的版本
+	delete(history, 3)
+	history[5] = applied{name: "removed"}
+	if _, err := downPlan(list, history, 1); err == nil {
+		t.Fatal("downPlan with missing files: want error")
+	}
+}
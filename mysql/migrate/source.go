@@ -0,0 +1,159 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 文件名格式 0001_create_user.up.sql / 0001_create_user.down.sql
+var fileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration 一个版本的迁移
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	//up 脚本的 sha256，用于发现已执行的脚本被修改
+	Checksum string
+}
+
+// Load 从 fsys 根目录读取迁移文件，按版本号排序
+// 磁盘目录使用 os.DirFS(dir)，embed.FS 使用 fs.Sub(files, "migrations")
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := fileRe.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %s: %w", entry.Name(), err)
+		}
+		b, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := versions[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			versions[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("duplicate migration version %d: %s, %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(b)
+			sum := sha256.Sum256(b)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(b)
+		}
+	}
+	list := make([]*Migration, 0, len(versions))
+	for _, mig := range versions {
+		if mig.Checksum == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		list = append(list, mig)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list, nil
+}
+
+// Create 在 dir 下创建下一个版本的 up/down 空文件，返回两个文件路径
+func Create(dir, name string) (up, down string, err error) {
+	name = strings.Trim(regexp.MustCompile(`[^a-zA-Z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", fmt.Errorf("migration name is empty")
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	list, err := Load(os.DirFS(dir))
+	if err != nil {
+		return
+	}
+	var version int64 = 1
+	if len(list) > 0 {
+		version = list[len(list)-1].Version + 1
+	}
+	prefix := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, name))
+	up, down = prefix+".up.sql", prefix+".down.sql"
+	header := fmt.Sprintf("-- %04d_%s created at %s\n", version, name, time.Now().Format("2006-01-02 15:04:05"))
+	if err = os.WriteFile(up, []byte(header), 0644); err != nil {
+		return
+	}
+	err = os.WriteFile(down, []byte(header), 0644)
+	return
+}
+
+// split 按分号拆分多条语句，忽略字符串、标识符和注释中的分号
+func split(script string) []string {
+	var list []string
+	var b strings.Builder
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(script); j++ {
+				if script[j] == '\\' && c != '`' {
+					j++
+					continue
+				}
+				if script[j] == c {
+					break
+				}
+			}
+			if j >= len(script) {
+				j = len(script) - 1
+			}
+			b.WriteString(script[i : j+1])
+			i = j
+		case c == '-' && i+1 < len(script) && script[i+1] == '-', c == '#':
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			b.WriteByte('\n')
+		case c == '/' && i+2 < len(script) && script[i+1] == '*' && script[i+2] != '!':
+			//保留 /*! */ 形式的版本注释
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+			b.WriteByte(' ')
+		case c == ';':
+			if s := strings.TrimSpace(b.String()); s != "" {
+				list = append(list, s)
+			}
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if s := strings.TrimSpace(b.String()); s != "" {
+		list = append(list, s)
+	}
+	return list
+}
@@ -0,0 +1,60 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"single without semicolon", "SELECT 1", []string{"SELECT 1"}},
+		{"multiple", "SELECT 1;\nSELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{"empty statements", " ;;\n; SELECT 1;;", []string{"SELECT 1"}},
+		{"only comments", "-- 0001_init created at now\n", nil},
+		{"semicolon in single quotes", "INSERT INTO t VALUES ('a;b');SELECT 1", []string{"INSERT INTO t VALUES ('a;b')", "SELECT 1"}},
+		{"escaped quote", `INSERT INTO t VALUES ('it\'s;ok');`, []string{`INSERT INTO t VALUES ('it\'s;ok')`}},
+		{"doubled quote", "INSERT INTO t VALUES ('it''s;ok');", []string{"INSERT INTO t VALUES ('it''s;ok')"}},
+		{"semicolon in double quotes", `SELECT "a;b";`, []string{`SELECT "a;b"`}},
+		{"semicolon in backticks", "CREATE TABLE `a;b` (id int);", []string{"CREATE TABLE `a;b` (id int)"}},
+		{"dash comment", "SELECT 1; -- drop; table\nSELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{"hash comment", "# note; here\nSELECT 1;", []string{"SELECT 1"}},
+		{"block comment", "SELECT /* a; b */ 1;", []string{"SELECT   1"}},
+		{"unterminated block comment", "SELECT 1; /* a; b", []string{"SELECT 1"}},
+		{"version comment kept", "/*!40101 SET NAMES utf8mb4 */;SELECT 1;", []string{"/*!40101 SET NAMES utf8mb4 */", "SELECT 1"}},
+		{"unterminated string", "SELECT 'a;b", []string{"SELECT 'a;b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := split(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("split(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_email.up.sql":     {Data: []byte("ALTER TABLE user ADD email varchar(64);")},
+		"0001_create_user.up.sql":   {Data: []byte("CREATE TABLE user (id int);")},
+		"0001_create_user.down.sql": {Data: []byte("DROP TABLE user;")},
+		"README.md":                 {Data: []byte("ignored")},
+	}
+	list, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Version != 1 || list[1].Version != 2 {
+		t.Fatalf("Load = %+v", list)
+	}
+	if list[0].Down != "DROP TABLE user;" || list[1].Down != "" || list[0].Checksum == "" {
+		t.Fatalf("Load = %+v, %+v", list[0], list[1])
+	}
+	if _, err := Load(fstest.MapFS{"0001_x.down.sql": {Data: []byte("DROP TABLE x;")}}); err == nil {
+		t.Fatal("Load without up file: want error")
+	}
+}
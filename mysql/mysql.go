@@ -8,8 +8,9 @@ import (
 	_ "github.com/go-sql-driver/mysql" // init mysql
 	"github.com/582033/gin-utils/apm"
 	"github.com/582033/gin-utils/config"
-	ctx2 "github.com/582033/gin-utils/ctx"
 	"github.com/582033/gin-utils/log"
+	"net/url"
+	"sort"
 	"sync"
 	"time"
 )
@@ -25,10 +26,53 @@ type Conf struct {
 	MaxOpenConns int    `json:"max_open_conns"`
 	MaxIdleConns int    `json:"max_idle_conns"`
 	Loc          string `json:"loc"`
+	//从库列表，未配置的连接参数沿用主库
+	Replicas []*Conf `json:"replicas"`
+	//从库权重，balance 为 weighted 时生效
+	Weight int `json:"weight"`
+	//从库选择策略 round_robin(默认) | weighted
+	Balance string `json:"balance"`
+	//从库最大复制延迟 秒，超过时不再路由到该从库，0 表示不检查
+	MaxLag int `json:"max_lag"`
+	//写成功后当前请求的读都走主库
+	StickyPrimary bool `json:"sticky_primary"`
+	//慢查询阈值 毫秒，0 使用默认值 1000，小于 0 不记录
+	SlowThreshold int `json:"slow_threshold"`
+	//慢查询为 SELECT 时记录执行计划
+	ExplainSlow bool `json:"explain_slow"`
+	//database/sql 驱动名，默认 mysql，其他驱动如 postgres、pgx、sqlite3 需要调用方导入
+	Driver string `json:"driver"`
+	//非 MySQL 驱动的连接串，MySQL 为空时由上面的参数生成
+	DSN string `json:"dsn"`
+	//方言，默认按驱动名选择
+	Dialect string `json:"dialect"`
+	//连接最长存活时间 秒，0 表示不限制，需要小于代理或服务端的空闲断开时间
+	ConnMaxLifetime int `json:"conn_max_lifetime"`
+	//连接最长空闲时间 秒，0 表示不限制
+	ConnMaxIdleTime int `json:"conn_max_idle_time"`
+	//TLS 模式 true | false | skip-verify | preferred，配置 tls_config 时使用自定义证书
+	TLS string `json:"tls"`
+	//自定义证书
+	TLSConfig *TLSConf `json:"tls_config"`
+	//附加的 DSN 参数，如 interpolateParams、collation，同名时覆盖默认参数
+	Params map[string]string `json:"params"`
 }
 
 type DBConn struct {
-	db *sql.DB
+	//实例名，配置文件中的 key
+	name          string
+	db            *sql.DB
+	replicas      *replicaSet
+	sticky        bool
+	slowThreshold time.Duration
+	explainSlow   bool
+	hookMu        sync.RWMutex
+	hooks         []Hook
+	packetOnce    sync.Once
+	maxPacket     int64
+	dialect       Dialect
+	//查询缓存的命名空间，区分不同库中的同名表
+	cacheScope string
 }
 
 func (dbConn *DBConn) Original() *sql.DB {
@@ -36,7 +80,12 @@ func (dbConn *DBConn) Original() *sql.DB {
 }
 
 type Tx struct {
-	tx *sql.Tx
+	tx     *sql.Tx
+	dbConn *DBConn
+	//嵌套事务层级，用于生成 SAVEPOINT 名称
+	depth int
+	//提交后执行，如使查询缓存失效
+	onCommit []func()
 }
 
 //保存连接对象
@@ -44,23 +93,60 @@ var conn = make(map[string]*DBConn)
 var once = sync.Once{}
 
 func (v Conf) String() string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&readTimeout=%ds&writeTimeout=%ds&timeout=%ds&parseTime=true&loc=%s",
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&readTimeout=%ds&writeTimeout=%ds&timeout=%ds&parseTime=true&loc=%s",
 		v.Username, v.Password, v.Host, v.Port, v.DBName, v.Charset, v.Timeout, v.Timeout, v.Timeout, v.Loc,
 	)
+	if name := v.tlsName(); name != "" {
+		dsn += "&tls=" + url.QueryEscape(name)
+	}
+	keys := make([]string, 0, len(v.Params))
+	for k := range v.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		dsn += "&" + url.QueryEscape(k) + "=" + url.QueryEscape(v.Params[k])
+	}
+	return dsn
 }
 
-func (v Conf) maxOpenConns() int {
+func (v Conf) maxOpenConns() (int, error) {
 	if v.MaxOpenConns == 0 {
-		log.Fatal("MaxOpenConns Must set")
+		return 0, fmt.Errorf("mysql %s:%d max_open_conns must be set", v.Host, v.Port)
 	}
-	return v.MaxOpenConns
+	return v.MaxOpenConns, nil
 }
 
-func (v Conf) maxIdleConns() int {
+func (v Conf) maxIdleConns() (int, error) {
 	if v.MaxIdleConns == 0 {
-		log.Fatal("MaxIdleConns Must set")
+		return 0, fmt.Errorf("mysql %s:%d max_idle_conns must be set", v.Host, v.Port)
+	}
+	return v.MaxIdleConns, nil
+}
+
+//redacted 不含账号密码的连接描述，用于日志
+func (v Conf) redacted() string {
+	if v.DSN != "" {
+		return v.Driver + " (dsn)"
+	}
+	return fmt.Sprintf("%s:%d/%s", v.Host, v.Port, v.DBName)
+}
+
+//setPool 设置连接池参数
+func (v Conf) setPool(db *sql.DB) error {
+	maxOpen, err := v.maxOpenConns()
+	if err != nil {
+		return err
+	}
+	maxIdle, err := v.maxIdleConns()
+	if err != nil {
+		return err
 	}
-	return v.MaxIdleConns
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(time.Duration(v.ConnMaxLifetime) * time.Second)
+	db.SetConnMaxIdleTime(time.Duration(v.ConnMaxIdleTime) * time.Second)
+	return nil
 }
 
 //_initDB db初始化
@@ -75,9 +161,10 @@ func _initDB() {
 		for k, v := range data {
 			dbConn, err := NewMysql(v)
 			if err != nil {
-				log.Fatal("InitDB ERROR ", k, " ", v.String())
+				log.Fatal("InitDB ERROR ", k, " ", v.redacted(), " ", err)
 				return
 			}
+			dbConn.name = k
 			conn[k] = dbConn
 		}
 		go stats()
@@ -96,14 +183,39 @@ func stats() {
 			apm.Gauges(k, "MaxOpenConnections").Update(int64(stats.MaxOpenConnections))
 			apm.Gauges(k, "OpenConnections").Update(int64(stats.OpenConnections))
 			apm.Gauges(k, "WaitDuration").Update(int64(stats.WaitDuration / time.Millisecond))
+			if v.replicas != nil {
+				v.replicas.stats(k)
+			}
 		}
 	}
 }
 
-//NewMysql 实例化db
+// NewMysql 创建连接，conf.Driver 不为 mysql 时按对应方言生成语句，从库只支持 MySQL
 func NewMysql(conf *Conf) (dbConn *DBConn, err error) {
+	driverName, dsn := conf.Driver, conf.DSN
+	if driverName == "" {
+		driverName = "mysql"
+	}
+	if dsn == "" {
+		dsn = conf.String()
+	}
+	name := conf.Dialect
+	if name == "" {
+		name = driverName
+	}
+	dialect, err := GetDialect(name)
+	if err != nil {
+		return nil, err
+	}
+	//从库的健康和延迟检查依赖 SHOW REPLICA STATUS
+	if len(conf.Replicas) > 0 && dialect.Name() != DialectMySQL {
+		return nil, fmt.Errorf("mysql %s: replicas are only supported for mysql, got %s", conf.redacted(), dialect.Name())
+	}
+	if err := conf.registerTLS(); err != nil {
+		return nil, err
+	}
 
-	db, err := sql.Open("mysql", conf.String())
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		log.Errorf("mysql conn Error %s", err.Error())
 		return nil, err
@@ -113,9 +225,26 @@ func NewMysql(conf *Conf) (dbConn *DBConn, err error) {
 		log.Errorf("Could not establish a connection with the database, detail: %s", err.Error())
 		return nil, err
 	}
-	db.SetMaxOpenConns(conf.maxOpenConns())
-	db.SetMaxIdleConns(conf.maxIdleConns())
-	return &DBConn{db: db}, nil
+	if err = conf.setPool(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	dbConn = &DBConn{
+		name:          fmt.Sprintf("%s:%d", conf.Host, conf.Port),
+		db:            db,
+		sticky:        conf.StickyPrimary,
+		slowThreshold: conf.slowThreshold(),
+		explainSlow:   conf.ExplainSlow,
+		dialect:       dialect,
+		cacheScope:    conf.cacheScope(),
+	}
+	if len(conf.Replicas) > 0 {
+		if dbConn.replicas, err = newReplicaSet(driverName, conf); err != nil {
+			log.Errorf("mysql replica conn Error %s", err.Error())
+			return nil, err
+		}
+	}
+	return dbConn, nil
 }
 
 //DB 对外获取db实例
@@ -137,7 +266,7 @@ func (dbConn *DBConn) Begin() (*Tx, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Tx{tx: tx}, nil
+	return &Tx{tx: tx, dbConn: dbConn}, nil
 }
 
 func (dbConn *DBConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
@@ -145,120 +274,136 @@ func (dbConn *DBConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, er
 	if err != nil {
 		return nil, err
 	}
-	return &Tx{tx: tx}, nil
+	return &Tx{tx: tx, dbConn: dbConn}, nil
 }
 
 // Deprecated: Use ExecContext
 func (dbConn *DBConn) Exec(query string, args ...interface{}) (sql.Result, error) {
-	s := time.Now()
+	query = dbConn.rebind(query)
+	c, e := dbConn.before(nil, "DB.Exec", false, nil, query, args)
 	res, err := dbConn.db.Exec(query, args...)
-	var affected int64
-	if res != nil {
-		affected, _ = res.RowsAffected()
-	}
-	log.Debugf("DB.Exec SQL: %s, args: %+v, affected: %v: %f", query, args, affected, time.Now().Sub(s).Seconds())
+	dbConn.after(c, e, res, err)
 	return res, err
 }
 
 // Deprecated: Use QueryContext
 func (dbConn *DBConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	s := time.Now()
-	res, err := dbConn.db.Query(query, args...)
-	log.Debugf("DB.Query SQL: %s, args: %+v: %f", query, args, time.Now().Sub(s).Seconds())
+	query = dbConn.rebind(query)
+	db := dbConn.reader(nil)
+	c, e := dbConn.before(nil, "DB.Query", false, db, query, args)
+	res, err := db.Query(query, args...)
+	dbConn.after(c, e, nil, err)
 	return res, err
 }
 
 // Deprecated: Use QueryRowContext
 func (dbConn *DBConn) QueryRow(query string, args ...interface{}) squirrel.RowScanner {
-	s := time.Now()
-	res := dbConn.db.QueryRow(query, args...)
-	log.Debugf("DB.QueryRow SQL: %s, args: %+v: %f", query, args, time.Now().Sub(s).Seconds())
+	query = dbConn.rebind(query)
+	db := dbConn.reader(nil)
+	c, e := dbConn.before(nil, "DB.QueryRow", false, db, query, args)
+	res := db.QueryRow(query, args...)
+	dbConn.after(c, e, nil, res.Err())
 	return res
 
 }
 
 func (dbConn *DBConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	s := time.Now()
-	res, err := dbConn.db.ExecContext(ctx, query, args...)
-	var affected int64
-	if res != nil {
-		affected, _ = res.RowsAffected()
+	query = dbConn.rebind(query)
+	c, e := dbConn.before(ctx, "DB.ExecContext", false, nil, query, args)
+	res, err := dbConn.db.ExecContext(c, query, args...)
+	if err == nil {
+		dbConn.afterWrite(ctx)
 	}
-	log.Debugf("[%+v] DB.ExecContext SQL: %s, args: %+v, affected: %v: %f", ctx.Value(ctx2.BaseContextRequestIDKey), query, args, affected, time.Now().Sub(s).Seconds())
+	dbConn.after(c, e, res, err)
 	return res, err
 }
 
 func (dbConn *DBConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	s := time.Now()
-	res, err := dbConn.db.QueryContext(ctx, query, args...)
-	log.Debugf("[%+v] DB.QueryContext SQL: %s, args: %+v: %f", ctx.Value(ctx2.BaseContextRequestIDKey), query, args, time.Now().Sub(s).Seconds())
+	query = dbConn.rebind(query)
+	db := dbConn.reader(ctx)
+	c, e := dbConn.before(ctx, "DB.QueryContext", false, db, query, args)
+	res, err := db.QueryContext(c, query, args...)
+	dbConn.after(c, e, nil, err)
 	return res, err
 }
 
 func (dbConn *DBConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) squirrel.RowScanner {
-	s := time.Now()
-	res := dbConn.db.QueryRowContext(ctx, query, args...)
-	log.Debugf("[%+v] DB.QueryRowContext SQL: %s, args: %+v: %f", ctx.Value(ctx2.BaseContextRequestIDKey), query, args, time.Now().Sub(s).Seconds())
+	query = dbConn.rebind(query)
+	db := dbConn.reader(ctx)
+	c, e := dbConn.before(ctx, "DB.QueryRowContext", false, db, query, args)
+	res := db.QueryRowContext(c, query, args...)
+	dbConn.after(c, e, nil, res.Err())
 	return res
 }
 
 func (tx *Tx) Commit() error {
-	return tx.tx.Commit()
+	if err := tx.tx.Commit(); err != nil {
+		return err
+	}
+	for _, fn := range tx.onCommit {
+		fn()
+	}
+	tx.onCommit = nil
+	return nil
 }
 
 func (tx *Tx) Rollback() error {
+	tx.onCommit = nil
 	return tx.tx.Rollback()
 }
 
+//afterCommit 注册提交后执行的函数，回滚时丢弃
+func (tx *Tx) afterCommit(fn func()) {
+	tx.onCommit = append(tx.onCommit, fn)
+}
+
 // Deprecated: Use ExecContext
 func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
-	s := time.Now()
+	query = tx.dbConn.rebind(query)
+	c, e := tx.dbConn.before(nil, "TX.Exec", true, nil, query, args)
 	res, err := tx.tx.Exec(query, args...)
-	var affected int64
-	if res != nil {
-		affected, _ = res.RowsAffected()
-	}
-	log.Debugf("TX.Exec SQL: %s, args: %+v, affected: %v: %f", query, args, affected, time.Now().Sub(s).Seconds())
+	tx.dbConn.after(c, e, res, err)
 	return res, err
 }
 
 // Deprecated: Use QueryContext
 func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	s := time.Now()
+	query = tx.dbConn.rebind(query)
+	c, e := tx.dbConn.before(nil, "TX.Query", true, tx.dbConn.db, query, args)
 	res, err := tx.tx.Query(query, args...)
-	log.Debugf("TX.Query SQL: %s, args: %+v: %f", query, args, time.Now().Sub(s).Seconds())
+	tx.dbConn.after(c, e, nil, err)
 	return res, err
 }
 
 // Deprecated: Use QueryRowContext
 func (tx *Tx) QueryRow(query string, args ...interface{}) squirrel.RowScanner {
-	s := time.Now()
+	query = tx.dbConn.rebind(query)
+	c, e := tx.dbConn.before(nil, "TX.QueryRow", true, tx.dbConn.db, query, args)
 	res := tx.tx.QueryRow(query, args...)
-	log.Debugf("TX.QueryRow SQL: %s, args: %+v: %f", query, args, time.Now().Sub(s).Seconds())
+	tx.dbConn.after(c, e, nil, res.Err())
 	return res
 }
 
 func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	s := time.Now()
-	res, err := tx.tx.ExecContext(ctx, query, args...)
-	var affected int64
-	if res != nil {
-		affected, _ = res.RowsAffected()
-	}
-	log.Debugf("[%+v] TX.ExecContext SQL: %s, args: %+v, affected: %v: %f", ctx.Value(ctx2.BaseContextRequestIDKey), query, args, affected, time.Now().Sub(s).Seconds())
+	query = tx.dbConn.rebind(query)
+	c, e := tx.dbConn.before(ctx, "TX.ExecContext", true, nil, query, args)
+	res, err := tx.tx.ExecContext(c, query, args...)
+	tx.dbConn.after(c, e, res, err)
 	return res, err
 }
 
 func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	s := time.Now()
-	res, err := tx.tx.QueryContext(ctx, query, args...)
-	log.Debugf("[%+v] TX.QueryContext SQL: %s, args: %+v: %f", ctx.Value(ctx2.BaseContextRequestIDKey), query, args, time.Now().Sub(s).Seconds())
+	query = tx.dbConn.rebind(query)
+	c, e := tx.dbConn.before(ctx, "TX.QueryContext", true, tx.dbConn.db, query, args)
+	res, err := tx.tx.QueryContext(c, query, args...)
+	tx.dbConn.after(c, e, nil, err)
 	return res, err
 }
 
 func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) squirrel.RowScanner {
-	s := time.Now()
-	res := tx.tx.QueryRowContext(ctx, query, args...)
-	log.Debugf("[%+v] TX.QueryRowContext SQL: %s, args: %+v: %f", ctx.Value(ctx2.BaseContextRequestIDKey), query, args, time.Now().Sub(s).Seconds())
+	query = tx.dbConn.rebind(query)
+	c, e := tx.dbConn.before(ctx, "TX.QueryRowContext", true, tx.dbConn.db, query, args)
+	res := tx.tx.QueryRowContext(c, query, args...)
+	tx.dbConn.after(c, e, nil, res.Err())
 	return res
 }
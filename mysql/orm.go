@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 
@@ -21,8 +22,47 @@ var cache = sync.Map{}
 type FiledInfo struct {
 	Name  string
 	Index []int
-	Tag   string
-	I     int
+	//列名
+	Tag string
+	I   int
+	//tag 中列名之后的选项，如 orm:"id,pk,auto"
+	Options map[string]string
+}
+
+const (
+	//OptPK 主键
+	OptPK = "pk"
+	//OptAuto 自增列，插入时跳过并回写生成的 ID
+	OptAuto = "auto"
+)
+
+//Has 是否设置了某个 tag 选项
+func (f FiledInfo) Has(opt string) bool {
+	_, ok := f.Options[opt]
+	return ok
+}
+
+//Option 获取 tag 选项的值，如 orm:"amount,conv=decimal"
+func (f FiledInfo) Option(opt string) string {
+	return f.Options[opt]
+}
+
+//parseTag 解析 orm tag，返回列名和选项
+func parseTag(tag string) (string, map[string]string) {
+	parts := strings.Split(tag, ",")
+	opts := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if i := strings.IndexByte(p, '='); i >= 0 {
+			opts[p[:i]] = p[i+1:]
+		} else {
+			opts[p] = ""
+		}
+	}
+	return strings.TrimSpace(parts[0]), opts
 }
 
 //Table 一张表
@@ -46,7 +86,7 @@ func toSliceStruct(rows *sql.Rows, t reflect.Type) (interface{}, error) {
 	var addrByColumnName = make(map[string]interface{}, len(fields))
 
 	for k, field := range fields {
-		addrByColumnName[k] = v.Elem().FieldByIndex(field.Index).Addr().Interface()
+		addrByColumnName[k] = field.scanDest(v.Elem().FieldByIndex(field.Index))
 	}
 
 	for _, columnName := range columnNames {
@@ -89,7 +129,7 @@ func toStruct(rows *sql.Rows, t reflect.Type) (Row, error) {
 	var addrByColumnName = make(map[string]interface{}, len(fields))
 
 	for k, field := range fields {
-		addrByColumnName[k] = v.Elem().FieldByIndex(field.Index).Addr().Interface()
+		addrByColumnName[k] = field.scanDest(v.Elem().FieldByIndex(field.Index))
 	}
 
 	for _, columnName := range columnNames {
@@ -103,10 +143,18 @@ func toStruct(rows *sql.Rows, t reflect.Type) (Row, error) {
 	return rowNew, rows.Scan(scanDest...)
 }
 
-//SelectScan
+//SelectScan 查询到 dest，使用 Preload 时 dest 的元素类型必须与 tbl 相同
 func SelectScan(ctx ctx.BaseContext, db sq.BaseRunner, tbl Table, selectBuilder func(tblName string) sq.SelectBuilder, dest interface{}) (err error) {
 
-	b := selectBuilder(tbl.TableName()).RunWith(db)
+	names := preloadNames(tbl)
+	tbl, sb, err := prepareSelect(ctx, tbl, selectBuilder)
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 && getType(dest) != getType(tbl) {
+		return fmt.Errorf("%s: preload needs dest of %s, got %s", tbl.TableName(), getType(tbl), getType(dest))
+	}
+	b := sb.RunWith(db)
 
 	rows, err := b.QueryContext(ctx)
 	if err != nil {
@@ -135,13 +183,24 @@ func SelectScan(ctx ctx.BaseContext, db sq.BaseRunner, tbl Table, selectBuilder
 			}
 		}
 		reflect.ValueOf(dest).Elem().Set(v)
-		return nil
+		if len(names) == 0 {
+			return nil
+		}
+		parents := make([]reflect.Value, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			parents = append(parents, reflect.Indirect(v.Index(i)))
+		}
+		return loadRelations(ctx, db, tbl, parents, names)
 	}
 	return
 }
 
 func SelectOneScan(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, selectBuilder func(tblName string) sq.SelectBuilder, dest ...interface{}) error {
-	b := selectBuilder(tbl.TableName()).RunWith(runner)
+	_, sb, err := prepareSelect(ctx, tbl, selectBuilder)
+	if err != nil {
+		return err
+	}
+	b := sb.RunWith(runner)
 	return b.QueryRowContext(ctx).Scan(dest...)
 }
 
@@ -158,7 +217,21 @@ func SelectOne(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, selectBuild
 }
 
 func Select(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, selectBuilder func(tblName string) sq.SelectBuilder) ([]Row, error) {
-	b := selectBuilder(tbl.TableName()).RunWith(runner)
+	names := preloadNames(tbl)
+	ttl, useCache := cacheTTL(tbl)
+	tbl, sb, err := prepareSelect(ctx, tbl, selectBuilder)
+	if err != nil {
+		return nil, err
+	}
+	if _, inTx := runner.(*Tx); useCache && !inTx {
+		return cachedSelect(ctx, runner, tbl, sb, names, ttl)
+	}
+	return selectRows(ctx, runner, tbl, sb, names)
+}
+
+//selectRows 执行查询并加载关联字段
+func selectRows(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, sb sq.SelectBuilder, names []string) ([]Row, error) {
+	b := sb.RunWith(runner)
 
 	rows, err := b.QueryContext(ctx)
 	if err != nil {
@@ -176,6 +249,17 @@ func Select(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, selectBuilder
 				return nil, err
 			}
 		}
+		if len(names) > 0 {
+			//先释放连接，避免在事务中嵌套查询
+			rows.Close()
+			parents := make([]reflect.Value, 0, len(list))
+			for _, row := range list {
+				parents = append(parents, reflect.ValueOf(row).Elem())
+			}
+			if err := loadRelations(ctx, runner, tbl, parents, names); err != nil {
+				return nil, err
+			}
+		}
 		return list, nil
 	}
 	return nil, fmt.Errorf("mysql select error")
@@ -183,7 +267,20 @@ func Select(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, selectBuilder
 
 //更新
 func Update(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, updateBuilder func(tblName string) sq.UpdateBuilder) (count int64, err error) {
-	b := updateBuilder(tbl.TableName()).RunWith(runner)
+	tbl, _ = unwrap(tbl)
+	ub := touchUpdated(tbl, updateBuilder(tbl.TableName()))
+	where, err := tenantWhere(ctx, tbl)
+	if err != nil {
+		return 0, err
+	}
+	if where != nil {
+		ub = ub.Where(where)
+	}
+	defer invalidate(runner, tbl)
+	if audited(tbl) {
+		return auditUpdate(ctx, runner, tbl, ub)
+	}
+	b := ub.RunWith(runner)
 
 	res, err := b.ExecContext(ctx)
 	if err != nil {
@@ -197,9 +294,22 @@ func Update(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, updateBuilder
 	return count, nil
 }
 
-//删除
+//删除，软删除表请使用 SoftDelete 或 DeleteByPK
 func Delete(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, deleteBuilder func(tblName string) sq.DeleteBuilder) (count int64, err error) {
-	b := deleteBuilder(tbl.TableName()).RunWith(runner)
+	tbl, _ = unwrap(tbl)
+	db := deleteBuilder(tbl.TableName())
+	where, err := tenantWhere(ctx, tbl)
+	if err != nil {
+		return 0, err
+	}
+	if where != nil {
+		db = db.Where(where)
+	}
+	defer invalidate(runner, tbl)
+	if audited(tbl) {
+		return auditDelete(ctx, runner, tbl, db)
+	}
+	b := db.RunWith(runner)
 
 	res, err := b.ExecContext(ctx)
 	if err != nil {
@@ -213,7 +323,7 @@ func Delete(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, deleteBuilder
 	return count, nil
 }
 
-//BulkInsert 批量插入
+//BulkInsert 批量插入，每批 100 条，遇到失败的批次时停止，需要更多控制时使用 BulkInsertWith
 func BulkInsert(ctx ctx.BaseContext, runner sq.BaseRunner, list ...Row) (count int64, err error) {
 	if len(list) == 0 {
 		return 0, nil
@@ -225,7 +335,7 @@ func BulkInsert(ctx ctx.BaseContext, runner sq.BaseRunner, list ...Row) (count i
 		if begin == end {
 			break
 		}
-		_, c, err := insertMany(ctx, runner, list[begin:end]...)
+		_, c, err := insertMany(ctx, runner, "", list[begin:end]...)
 		if err != nil {
 			return count, err
 		}
@@ -234,40 +344,71 @@ func BulkInsert(ctx ctx.BaseContext, runner sq.BaseRunner, list ...Row) (count i
 	return
 }
 
-//insertMany 写入
-func insertMany(ctx ctx.BaseContext, runner sq.BaseRunner, list ...Row) (lastID, count int64, err error) {
+//insertMany 写入，into 不为空时写入该表，用于分表
+func insertMany(ctx ctx.BaseContext, runner sq.BaseRunner, into string, list ...Row) (lastID, count int64, err error) {
 	if len(list) == 0 || len(list) > 100 {
 		return 0, 0, fmt.Errorf("batch insertion limit 0-100")
 	}
-	obj := list[0]
-	fields := getField(obj)
-	if len(fields) == 0 {
-		return 0, 0, fmt.Errorf("add 'orm' tag to the struct")
+	return insertBatch(ctx, runner, into, false, list)
+}
+
+//setAutoID 回写自增 ID
+//多行插入时 MySQL 返回第一行的 ID，按 auto_increment_increment=1 依次递增回写
+func setAutoID(list []Row, lastID int64) {
+	if lastID <= 0 {
+		return
 	}
-	fieldList := make([]string, 0, len(fields))
-	fieldNames := make([]FiledInfo, 0, len(fields))
-	for k, v := range fields {
-		fieldList = append(fieldList, k)
-		fieldNames = append(fieldNames, v)
+	ids := make([]int64, len(list))
+	for i := range ids {
+		ids[i] = lastID + int64(i)
 	}
-	b := sq.Insert(obj.TableName()).Columns(fieldList...)
-	for _, info := range list {
-		b = b.Values(getValue(info, fieldNames)...)
+	setAutoIDs(list, ids)
+}
+
+//setAutoIDs 按顺序回写每行的自增 ID
+func setAutoIDs(list []Row, ids []int64) {
+	auto, ok := findOpt(list[0], OptAuto)
+	if !ok {
+		return
 	}
-	b = b.RunWith(runner)
+	for i, row := range list {
+		v := reflect.ValueOf(row)
+		if v.Kind() != reflect.Ptr || v.IsNil() || i >= len(ids) {
+			continue
+		}
+		setInt(v.Elem().FieldByIndex(auto.Index), ids[i])
+	}
+}
 
-	res, err := b.ExecContext(ctx)
-	if err != nil {
-		return 0, 0, err
+//insertBuilder 按 orm tag 生成批量写入语句，skipAuto 时跳过自增列
+func insertBuilder(list []Row, skipAuto bool) (sq.InsertBuilder, error) {
+	obj := list[0]
+	all := sortedField(obj)
+	if len(all) == 0 {
+		return sq.InsertBuilder{}, fmt.Errorf("add 'orm' tag to the struct")
 	}
-	count, _ = res.RowsAffected()
-	lastID, _ = res.LastInsertId()
-	return
+	if _, _, err := softDeleteField(obj); err != nil {
+		return sq.InsertBuilder{}, err
+	}
+	fields := make([]FiledInfo, 0, len(all))
+	columns := make([]string, 0, len(all))
+	for _, f := range all {
+		if skipAuto && f.Has(OptAuto) {
+			continue
+		}
+		fields = append(fields, f)
+		columns = append(columns, f.Tag)
+	}
+	b := sq.Insert(obj.TableName()).Columns(columns...)
+	for _, info := range list {
+		b = b.Values(getValue(info, fields)...)
+	}
+	return b, nil
 }
 
 //插入单条
 func Insert(ctx ctx.BaseContext, runner sq.BaseRunner, row Row) (lastID int64, err error) {
-	lastID, _, err = insertMany(ctx, runner, row)
+	lastID, _, err = insertMany(ctx, runner, "", row)
 	return
 }
 
@@ -290,8 +431,22 @@ func getField(obj interface{}) map[string]FiledInfo {
 	return data
 }
 
+//sortedField 按结构体字段顺序返回 orm 信息
+func sortedField(obj interface{}) []FiledInfo {
+	fields := getField(obj)
+	list := make([]FiledInfo, 0, len(fields))
+	for _, info := range fields {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].I < list[j].I
+	})
+	return list
+}
+
 type F []string
 
+//ToString 以 MySQL 反引号引用列名，其他数据库使用 Quoted
 func (f F) ToString() string {
 	return "`" + strings.Join([]string(f), "`,`") + "`"
 }
@@ -322,16 +477,17 @@ func getFieldWithoutCache(index []int, t reflect.Type, n int) map[string]FiledIn
 	data := make(map[string]FiledInfo)
 	for i := 0; i < t.NumField(); i++ {
 		item := t.Field(i)
-		k := item.Tag.Get("orm")
+		idx := append(append(make([]int, 0, len(index)+1), index...), i)
+		k, opts := parseTag(item.Tag.Get("orm"))
 		if k != "" && k != "-" {
-			data[k] = FiledInfo{Name: item.Name, Tag: k, Index: append(index, i), I: n}
+			data[k] = FiledInfo{Name: item.Name, Tag: k, Index: idx, I: n, Options: opts}
 			n++
 		}
 		if !item.Anonymous {
 			continue
 		}
 		if item.Type.Kind() == reflect.Struct {
-			m := getFieldWithoutCache(append(index, i), item.Type, n)
+			m := getFieldWithoutCache(idx, item.Type, n)
 			n = n + len(m)
 			for k, v := range m {
 				data[k] = v
@@ -349,7 +505,7 @@ func getValue(obj Table, fs []FiledInfo) []interface{} {
 	}
 	data := make([]interface{}, 0, len(fs))
 	for _, f := range fs {
-		data = append(data, v.FieldByIndex(f.Index).Interface())
+		data = append(data, f.value(v.FieldByIndex(f.Index)))
 	}
 	return data
 }
@@ -379,7 +535,7 @@ func GetTagWithValue(obj interface{}) map[string]interface{} {
 
 	result := make(map[string]interface{})
 	for _, f := range fields {
-		result[f.Tag] = v.FieldByIndex(f.Index).Interface()
+		result[f.Tag] = f.value(v.FieldByIndex(f.Index))
 	}
 	return result
 }
@@ -0,0 +1,266 @@
+package mysql
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/582033/gin-utils/ctx"
+
+	sq "github.com/Masterminds/squirrel"
+	_ "modernc.org/sqlite"
+)
+
+type testOrder struct {
+	ID        int64  `orm:"id,pk,auto"`
+	TenantID  string `orm:"tenant_id,tenant"`
+	Title     string `orm:"title"`
+	Amount    int64  `orm:"amount"`
+	DeletedAt int64  `orm:"deleted_at,softdelete"`
+}
+
+func (*testOrder) TableName() string {
+	return "orders"
+}
+
+func newTestDB(t *testing.T) *DBConn {
+	t.Helper()
+	db, err := NewMysql(&Conf{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "test.db"), MaxOpenConns: 1, MaxIdleConns: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Original().Close()
+	})
+	_, err = db.Exec(`CREATE TABLE orders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		amount INTEGER NOT NULL DEFAULT 0,
+		deleted_at INTEGER NOT NULL DEFAULT 0
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestNewMysqlReplicasNeedMySQL(t *testing.T) {
+	conf := &Conf{
+		Driver:       "sqlite",
+		DSN:          filepath.Join(t.TempDir(), "test.db"),
+		MaxOpenConns: 1,
+		MaxIdleConns: 1,
+		Replicas:     []*Conf{{DSN: filepath.Join(t.TempDir(), "replica.db")}},
+	}
+	if _, err := NewMysql(conf); err == nil {
+		t.Fatal("NewMysql sqlite with replicas: want error")
+	}
+}
+
+func tenantCtx(tenant string) *ctx.Base {
+	c := ctx.NewNilBaseContext()
+	c.SetTenant(tenant)
+	return c
+}
+
+func selectTitles(t *testing.T, c ctx.BaseContext, db *DBConn, tbl Table) []string {
+	t.Helper()
+	list, err := Select(c, db, tbl, func(tblName string) sq.SelectBuilder {
+		return sq.Select("*").From(tblName).OrderBy("id")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := make([]string, 0, len(list))
+	for _, row := range list {
+		titles = append(titles, row.(*testOrder).Title)
+	}
+	return titles
+}
+
+func TestCRUD(t *testing.T) {
+	db := newTestDB(t)
+	c := tenantCtx("a")
+	id, err := Insert(c, db, &testOrder{Title: "first", Amount: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Fatalf("Insert id = %d, want 1", id)
+	}
+	if _, err := Insert(c, db, &testOrder{Title: "second", Amount: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	row, err := SelectOne(c, db, &testOrder{}, func(tblName string) sq.SelectBuilder {
+		return sq.Select("*").From(tblName).Where(sq.Eq{"id": id})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := row.(*testOrder); o.Title != "first" || o.Amount != 10 || o.TenantID != "a" {
+		t.Fatalf("SelectOne = %+v", o)
+	}
+
+	n, err := Update(c, db, &testOrder{}, func(tblName string) sq.UpdateBuilder {
+		return sq.Update(tblName).Set("amount", 15).Where(sq.Eq{"id": id})
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("Update = %d, %v", n, err)
+	}
+	row, err = FindByPK(c, db, &testOrder{}, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := row.(*testOrder); o.Amount != 15 {
+		t.Fatalf("amount after Update = %d, want 15", o.Amount)
+	}
+
+	n, err = Delete(c, db, &testOrder{}, func(tblName string) sq.DeleteBuilder {
+		return sq.Delete(tblName).Where(sq.Eq{"id": id})
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("Delete = %d, %v", n, err)
+	}
+	if titles := selectTitles(t, c, db, &testOrder{}); len(titles) != 1 || titles[0] != "second" {
+		t.Fatalf("Select after Delete = %v", titles)
+	}
+}
+
+func TestSelectScanPreloadType(t *testing.T) {
+	db := newTestDB(t)
+	c := tenantCtx("a")
+	var titles []struct {
+		Title string `orm:"title"`
+	}
+	err := SelectScan(c, db, Preload(&testOrder{}, "Items"), func(tblName string) sq.SelectBuilder {
+		return sq.Select("title").From(tblName)
+	}, &titles)
+	if err == nil {
+		t.Fatal("SelectScan with preload into another type: want error")
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	db := newTestDB(t)
+	c := tenantCtx("a")
+	for _, title := range []string{"keep", "drop"} {
+		if _, err := Insert(c, db, &testOrder{Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	byTitle := func(tblName string) sq.UpdateBuilder {
+		return sq.Update(tblName).Where(sq.Eq{"title": "drop"})
+	}
+	n, err := SoftDelete(c, db, &testOrder{}, byTitle)
+	if err != nil || n != 1 {
+		t.Fatalf("SoftDelete = %d, %v", n, err)
+	}
+	//已删除的记录不会被再次删除
+	if n, err = SoftDelete(c, db, &testOrder{}, byTitle); err != nil || n != 0 {
+		t.Fatalf("SoftDelete again = %d, %v", n, err)
+	}
+	if titles := selectTitles(t, c, db, &testOrder{}); len(titles) != 1 || titles[0] != "keep" {
+		t.Fatalf("Select after SoftDelete = %v", titles)
+	}
+	if titles := selectTitles(t, c, db, Unscoped(&testOrder{})); len(titles) != 2 {
+		t.Fatalf("Unscoped Select = %v", titles)
+	}
+	if n, err = Restore(c, db, &testOrder{}, byTitle); err != nil || n != 1 {
+		t.Fatalf("Restore = %d, %v", n, err)
+	}
+	if titles := selectTitles(t, c, db, &testOrder{}); len(titles) != 2 {
+		t.Fatalf("Select after Restore = %v", titles)
+	}
+}
+
+func TestTenantScope(t *testing.T) {
+	db := newTestDB(t)
+	a, b := tenantCtx("a"), tenantCtx("b")
+	if _, err := Insert(a, db, &testOrder{Title: "a1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Insert(b, db, &testOrder{Title: "b1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Insert(a, db, &testOrder{TenantID: "b", Title: "forged"}); err == nil {
+		t.Fatal("Insert row of another tenant: want error")
+	}
+
+	if titles := selectTitles(t, a, db, &testOrder{}); len(titles) != 1 || titles[0] != "a1" {
+		t.Fatalf("tenant a Select = %v", titles)
+	}
+	n, err := Update(a, db, &testOrder{}, func(tblName string) sq.UpdateBuilder {
+		return sq.Update(tblName).Set("title", "changed")
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("tenant a Update = %d, %v", n, err)
+	}
+	n, err = Delete(a, db, &testOrder{}, func(tblName string) sq.DeleteBuilder {
+		return sq.Delete(tblName).Where(sq.Eq{"title": "b1"})
+	})
+	if err != nil || n != 0 {
+		t.Fatalf("tenant a Delete row of b = %d, %v", n, err)
+	}
+	if titles := selectTitles(t, b, db, &testOrder{}); len(titles) != 1 || titles[0] != "b1" {
+		t.Fatalf("tenant b Select = %v", titles)
+	}
+
+	//结构体中的租户不会写入 SET，显式指定其他租户时报错
+	moved := &testOrder{ID: 1, TenantID: "b", Title: "moved"}
+	if n, err = UpdateByPK(a, db, moved); err != nil || n != 1 {
+		t.Fatalf("UpdateByPK = %d, %v", n, err)
+	}
+	if titles := selectTitles(t, a, db, &testOrder{}); len(titles) != 1 || titles[0] != "moved" {
+		t.Fatalf("tenant a Select after UpdateByPK = %v", titles)
+	}
+	if _, err = UpdateByPK(a, db, moved, "tenant_id"); err == nil {
+		t.Fatal("UpdateByPK tenant_id to another tenant: want error")
+	}
+	if _, err = UpdateByPK(a, db, &testOrder{ID: 1, TenantID: "a"}, "tenant_id"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Select(ctx.NewNilBaseContext(), db, &testOrder{}, func(tblName string) sq.SelectBuilder {
+		return sq.Select("*").From(tblName)
+	})
+	if !errors.Is(err, ErrNoTenant) {
+		t.Fatalf("Select without tenant err = %v, want ErrNoTenant", err)
+	}
+	c := ctx.NewNilBaseContext()
+	err = CrossTenant(c, func() error {
+		if titles := selectTitles(t, c, db, &testOrder{}); len(titles) != 2 {
+			t.Fatalf("CrossTenant Select = %v", titles)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testArticle struct {
+	ID        int64  `orm:"id,pk,auto"`
+	Title     string `orm:"title"`
+	UpdatedAt int64  `orm:"updated_at,updated"`
+}
+
+func (*testArticle) TableName() string {
+	return "articles"
+}
+
+func TestTouchUpdatedKeepsExplicitColumn(t *testing.T) {
+	b := touchUpdated(&testArticle{}, sq.Update("articles").Set("updated_at", 1).Where(sq.Eq{"id": 1}))
+	query, args, err := b.ToSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "UPDATE articles SET updated_at = ? WHERE id = ?" || args[0] != 1 {
+		t.Fatalf("touchUpdated = %s %v", query, args)
+	}
+	b = touchUpdated(&testArticle{}, sq.Update("articles").Set("title", "x"))
+	if query, _, _ = b.ToSql(); query != "UPDATE articles SET title = ?, updated_at = ?" {
+		t.Fatalf("touchUpdated without updated_at = %s", query)
+	}
+}
@@ -0,0 +1,191 @@
+package mysql
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/582033/gin-utils/ctx"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Page 分页结果
+type Page[T any] struct {
+	Items []T    `json:"items"`
+	Total int64  `json:"total"`
+	Page  uint64 `json:"page"`
+	Size  uint64 `json:"size"`
+}
+
+// CursorPage 游标分页结果，Next 为空表示没有下一页
+type CursorPage[T any] struct {
+	Items   []T    `json:"items"`
+	Next    string `json:"next"`
+	HasMore bool   `json:"has_more"`
+}
+
+// SortKey 游标分页的排序列，最后一列需要唯一，如主键
+// 比较条件无法匹配 NULL，排序列不能是指针或 sql.Null* 类型
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+// Count 统计 selectBuilder 的结果行数，会去掉 limit/offset
+func Count(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, selectBuilder func(tblName string) sq.SelectBuilder) (total int64, err error) {
+	_, sb, err := prepareSelect(ctx, tbl, selectBuilder)
+	if err != nil {
+		return 0, err
+	}
+	b := sq.Select("COUNT(*)").FromSelect(sb.RemoveLimit().RemoveOffset(), "t").RunWith(runner)
+	err = b.QueryRowContext(ctx).Scan(&total)
+	return
+}
+
+// Paginate 分页查询，page 从 1 开始
+func Paginate(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, selectBuilder func(tblName string) sq.SelectBuilder, page, size uint64) (*Page[Row], error) {
+	if page == 0 {
+		page = 1
+	}
+	if size == 0 {
+		size = 10
+	}
+	total, err := Count(ctx, runner, tbl, selectBuilder)
+	if err != nil {
+		return nil, err
+	}
+	result := &Page[Row]{Items: []Row{}, Total: total, Page: page, Size: size}
+	offset := (page - 1) * size
+	if uint64(total) <= offset {
+		return result, nil
+	}
+	list, err := Select(ctx, runner, tbl, func(tblName string) sq.SelectBuilder {
+		return selectBuilder(tblName).Limit(size).Offset(offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if list != nil {
+		result.Items = list
+	}
+	return result, nil
+}
+
+// PaginateCursor 游标(keyset)分页，cursor 为上一页返回的 Next，首页传空
+// selectBuilder 中不要写 ORDER BY 和 LIMIT，按 keys 排序
+func PaginateCursor(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, selectBuilder func(tblName string) sq.SelectBuilder, cursor string, size uint64, keys ...SortKey) (*CursorPage[Row], error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("cursor pagination needs at least one sort key")
+	}
+	if size == 0 {
+		size = 10
+	}
+	raw, _ := unwrap(tbl)
+	fields := getField(raw)
+	for _, k := range keys {
+		f, ok := fields[k.Column]
+		if !ok {
+			return nil, fmt.Errorf("%s has no column %s", raw.TableName(), k.Column)
+		}
+		if t := fieldType(raw, f); nullable(t) {
+			return nil, fmt.Errorf("%s.%s: nullable %s can not be a cursor sort key", raw.TableName(), k.Column, t)
+		}
+	}
+	after, err := decodeCursor(raw, cursor, keys)
+	if err != nil {
+		return nil, err
+	}
+	list, err := Select(ctx, runner, tbl, func(tblName string) sq.SelectBuilder {
+		b := selectBuilder(tblName)
+		if after != nil {
+			b = b.Where(after)
+		}
+		orders := make([]string, 0, len(keys))
+		for _, k := range keys {
+			if k.Desc {
+				orders = append(orders, k.Column+" DESC")
+			} else {
+				orders = append(orders, k.Column+" ASC")
+			}
+		}
+		return b.OrderBy(orders...).Limit(size + 1)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := &CursorPage[Row]{Items: []Row{}}
+	if uint64(len(list)) > size {
+		list = list[:size]
+		result.HasMore = true
+	}
+	if len(list) > 0 {
+		result.Items = list
+	}
+	if result.HasMore {
+		if result.Next, err = encodeCursor(list[len(list)-1], keys); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+//nullable 字段类型是否可以为 NULL
+func nullable(t reflect.Type) bool {
+	return t.Kind() == reflect.Ptr || (t.PkgPath() == "database/sql" && strings.HasPrefix(t.Name(), "Null"))
+}
+
+//encodeCursor 将最后一行的排序列编码为游标
+func encodeCursor(row Row, keys []SortKey) (string, error) {
+	fields := getField(row)
+	v := reflect.Indirect(reflect.ValueOf(row))
+	values := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, v.FieldByIndex(fields[k.Column].Index).Interface())
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+//decodeCursor 解析游标，生成 (k1, k2) > (v1, v2) 的展开条件，支持每列不同的排序方向
+func decodeCursor(tbl Table, cursor string, keys []SortKey) (sq.Sqlizer, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil || len(raw) != len(keys) {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	fields := getField(tbl)
+	values := make([]interface{}, 0, len(keys))
+	for i, k := range keys {
+		ptr := reflect.New(fieldType(tbl, fields[k.Column]))
+		if err := json.Unmarshal(raw[i], ptr.Interface()); err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		values = append(values, ptr.Elem().Interface())
+	}
+	or := make(sq.Or, 0, len(keys))
+	for i, k := range keys {
+		and := make(sq.And, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, sq.Eq{keys[j].Column: values[j]})
+		}
+		if k.Desc {
+			and = append(and, sq.Lt{k.Column: values[i]})
+		} else {
+			and = append(and, sq.Gt{k.Column: values[i]})
+		}
+		or = append(or, and)
+	}
+	return or, nil
+}
@@ -0,0 +1,132 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	keys := []SortKey{{Column: "amount", Desc: true}, {Column: "id"}}
+	cursor, err := encodeCursor(&testOrder{ID: 5, Amount: 30}, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	where, err := decodeCursor(&testOrder{}, cursor, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args, err := where.ToSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "((amount < ?) OR (amount = ? AND id > ?))"; query != want {
+		t.Fatalf("decodeCursor = %s, want %s", query, want)
+	}
+	if want := []interface{}{int64(30), int64(30), int64(5)}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("decodeCursor args = %v, want %v", args, want)
+	}
+	if where, err := decodeCursor(&testOrder{}, "", keys); where != nil || err != nil {
+		t.Fatalf("decodeCursor empty = %v, %v", where, err)
+	}
+
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	invalid := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "!!!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`[30,50]`))},
+		{"not json", encode("30,5")},
+		{"not array", encode(`{"amount":30}`)},
+		{"too few values", encode(`[30]`)},
+		{"too many values", encode(`[30,5,1]`)},
+		{"wrong type", encode(`["30",5]`)},
+		{"fraction for integer", encode(`[30.5,5]`)},
+		{"sql injection", encode(`["1 OR 1=1",5]`)},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(&testOrder{}, tt.cursor, keys); err == nil {
+				t.Fatalf("decodeCursor(%q): want error", tt.cursor)
+			}
+		})
+	}
+}
+
+func TestPaginateCursor(t *testing.T) {
+	db := newTestDB(t)
+	c := tenantCtx("a")
+	for _, amount := range []int64{10, 30, 20, 30, 10} {
+		if _, err := Insert(c, db, &testOrder{Title: "o", Amount: amount}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all := func(tblName string) sq.SelectBuilder {
+		return sq.Select("*").From(tblName)
+	}
+	var ids []int64
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		page, err := PaginateCursor(c, db, &testOrder{}, all, cursor, 2, SortKey{Column: "amount", Desc: true}, SortKey{Column: "id"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range page.Items {
+			ids = append(ids, row.(*testOrder).ID)
+		}
+		if !page.HasMore {
+			break
+		}
+		cursor = page.Next
+	}
+	if want := []int64{2, 4, 3, 1, 5}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("PaginateCursor ids = %v, want %v", ids, want)
+	}
+}
+
+func TestPaginateCursorNullableKey(t *testing.T) {
+	tests := []struct {
+		name string
+		tbl  Table
+	}{
+		{"pointer", &nullableSortOrder{}},
+		{"sql.NullInt64", &nullSortOrder{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := PaginateCursor(tenantCtx("a"), nil, tt.tbl, func(tblName string) sq.SelectBuilder {
+				return sq.Select("*").From(tblName)
+			}, "", 10, SortKey{Column: "rank"}, SortKey{Column: "id"})
+			if err == nil {
+				t.Fatal("PaginateCursor with nullable sort key: want error")
+			}
+		})
+	}
+}
+
+type nullableSortOrder struct {
+	ID   int64  `orm:"id,pk,auto"`
+	Rank *int64 `orm:"rank"`
+}
+
+func (*nullableSortOrder) TableName() string {
+	return "orders"
+}
+
+type nullSortOrder struct {
+	ID   int64         `orm:"id,pk,auto"`
+	Rank sql.NullInt64 `orm:"rank"`
+}
+
+func (*nullSortOrder) TableName() string {
+	return "orders"
+}
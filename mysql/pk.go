@@ -0,0 +1,141 @@
+package mysql
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/582033/gin-utils/ctx"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// pkFields 主键字段，按结构体字段顺序，支持联合主键
+func pkFields(tbl Table) ([]FiledInfo, error) {
+	var list []FiledInfo
+	for _, f := range sortedField(tbl) {
+		if f.Has(OptPK) {
+			list = append(list, f)
+		}
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%s has no primary key, add 'pk' option to the orm tag", tbl.TableName())
+	}
+	return list, nil
+}
+
+// pkWhere 由主键值生成查询条件
+func pkWhere(tbl Table, ids []interface{}) (sq.Eq, error) {
+	pks, err := pkFields(tbl)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) != len(pks) {
+		return nil, fmt.Errorf("%s has %d primary key columns, got %d values", tbl.TableName(), len(pks), len(ids))
+	}
+	where := make(sq.Eq, len(pks))
+	for i, f := range pks {
+		where[f.Tag] = ids[i]
+	}
+	return where, nil
+}
+
+// FindByPK 按主键查询一条记录，联合主键按字段顺序传入，不存在时返回 sql.ErrNoRows
+func FindByPK(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, ids ...interface{}) (Row, error) {
+	raw, _ := unwrap(tbl)
+	where, err := pkWhere(raw, ids)
+	if err != nil {
+		return nil, err
+	}
+	return SelectOne(ctx, runner, tbl, func(tblName string) sq.SelectBuilder {
+		return sq.Select(Field(raw)...).From(tblName).Where(where).Limit(1)
+	})
+}
+
+// UpdateByPK 按主键更新，指定 columns 时只更新这些列，否则更新所有非零值字段
+// 默认不更新租户列，指定租户列时值必须是当前租户，跨租户时不检查
+// 有 version 列时附加 version 条件并加 1，没有更新到记录时返回 ErrStaleObject，成功后回写新版本号
+func UpdateByPK(ctx ctx.BaseContext, runner sq.BaseRunner, row Row, columns ...string) (count int64, err error) {
+	row, _ = unwrap(row)
+	pks, err := pkFields(row)
+	if err != nil {
+		return 0, err
+	}
+	v := reflect.Indirect(reflect.ValueOf(row))
+	where := make(sq.Eq, len(pks))
+	for _, f := range pks {
+		where[f.Tag] = v.FieldByIndex(f.Index).Interface()
+	}
+
+	_, tenant, scoped, err := tenantScope(ctx, row)
+	if err != nil {
+		return 0, err
+	}
+	fields := getField(row)
+	set := make(map[string]interface{})
+	if len(columns) > 0 {
+		for _, c := range columns {
+			f, ok := fields[c]
+			if !ok {
+				return 0, fmt.Errorf("%s has no column %s", row.TableName(), c)
+			}
+			fv := v.FieldByIndex(f.Index)
+			if scoped && f.Has(OptTenant) && fmt.Sprint(fv.Interface()) != tenant {
+				return 0, fmt.Errorf("%s: row can not be moved to tenant %v by tenant %s", row.TableName(), fv.Interface(), tenant)
+			}
+			set[c] = f.value(fv)
+		}
+	} else {
+		for _, f := range fields {
+			if f.Has(OptPK) || f.Has(OptAuto) || f.Has(OptCreated) || f.Has(OptUpdated) || f.Has(OptSoftDelete) || f.Has(OptVersion) || f.Has(OptTenant) {
+				continue
+			}
+			if fv := v.FieldByIndex(f.Index); !fv.IsZero() {
+				set[f.Tag] = f.value(fv)
+			}
+		}
+	}
+	if len(set) == 0 {
+		return 0, nil
+	}
+	version, hasVersion := findOpt(row, OptVersion)
+	var next int64
+	if hasVersion {
+		delete(set, version.Tag)
+		cur := v.FieldByIndex(version.Index)
+		where[version.Tag] = cur.Interface()
+		next = versionValue(cur) + 1
+		set[version.Tag] = next
+	}
+	count, err = Update(ctx, runner, row, func(tblName string) sq.UpdateBuilder {
+		return sq.Update(tblName).SetMap(set).Where(where)
+	})
+	if err != nil || !hasVersion {
+		return count, err
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("%w: %s %v", ErrStaleObject, row.TableName(), where)
+	}
+	setInt(v.FieldByIndex(version.Index), next)
+	return count, nil
+}
+
+// DeleteByPK 按主键删除，有 softdelete 列时为软删除，使用 Unscoped(tbl) 物理删除
+func DeleteByPK(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, ids ...interface{}) (count int64, err error) {
+	tbl, scoped := unwrap(tbl)
+	where, err := pkWhere(tbl, ids)
+	if err != nil {
+		return 0, err
+	}
+	_, soft, err := softDeleteField(tbl)
+	if err != nil {
+		return 0, err
+	}
+	if soft && scoped {
+		return SoftDelete(ctx, runner, tbl, func(tblName string) sq.UpdateBuilder {
+			return sq.Update(tblName).Where(where)
+		})
+	}
+	return Delete(ctx, runner, tbl, func(tblName string) sq.DeleteBuilder {
+		return sq.Delete(tblName).Where(where)
+	})
+}
@@ -0,0 +1,265 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/582033/gin-utils/ctx"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	//RelHasOne 一对一，子表的 fk 列引用父表的 ref 列
+	RelHasOne = "has_one"
+	//RelHasMany 一对多，子表的 fk 列引用父表的 ref 列
+	RelHasMany = "has_many"
+)
+
+// relation 关联字段，由 rel tag 声明，ref 默认为父表主键
+//
+//	type Order struct {
+//		ID    int64        `orm:"id,pk,auto"`
+//		Items []*OrderItem `rel:"has_many,fk=order_id"`
+//		Pay   *Payment     `rel:"has_one,fk=order_no,ref=order_no"`
+//	}
+type relation struct {
+	Name  string
+	Index []int
+	Kind  string
+	FK    string
+	Ref   string
+	//子表结构体类型
+	Elem reflect.Type
+	//字段为切片或指针时元素是否为指针
+	Ptr bool
+}
+
+var relCache sync.Map
+
+//relations 解析结构体中的关联字段
+func relations(tbl Table) (map[string]relation, error) {
+	tbl, _ = unwrap(tbl)
+	t := getType(tbl)
+	if v, ok := relCache.Load(t); ok {
+		return v.(map[string]relation), nil
+	}
+	data := make(map[string]relation)
+	for i := 0; i < t.NumField(); i++ {
+		item := t.Field(i)
+		tag := item.Tag.Get("rel")
+		if tag == "" {
+			continue
+		}
+		kind, opts := parseTag(tag)
+		r := relation{Name: item.Name, Index: item.Index, Kind: kind, FK: opts["fk"], Ref: opts["ref"]}
+		if r.FK == "" {
+			return nil, fmt.Errorf("%s.%s: rel tag needs fk", t.Name(), item.Name)
+		}
+		if r.Ref == "" {
+			pks, err := pkFields(tbl)
+			if err != nil || len(pks) != 1 {
+				return nil, fmt.Errorf("%s.%s: rel tag needs ref when table has no single primary key", t.Name(), item.Name)
+			}
+			r.Ref = pks[0].Tag
+		}
+		if _, ok := getField(tbl)[r.Ref]; !ok {
+			return nil, fmt.Errorf("%s.%s: %s has no column %s", t.Name(), item.Name, tbl.TableName(), r.Ref)
+		}
+		ft := item.Type
+		switch kind {
+		case RelHasMany:
+			if ft.Kind() != reflect.Slice {
+				return nil, fmt.Errorf("%s.%s: has_many field must be a slice", t.Name(), item.Name)
+			}
+			ft = ft.Elem()
+		case RelHasOne:
+		default:
+			return nil, fmt.Errorf("%s.%s: unknown relation %s", t.Name(), item.Name, kind)
+		}
+		if ft.Kind() == reflect.Ptr {
+			r.Ptr = true
+			ft = ft.Elem()
+		}
+		if _, ok := reflect.New(ft).Interface().(Table); !ok {
+			return nil, fmt.Errorf("%s.%s: %s does not implement mysql.Table", t.Name(), item.Name, ft.Name())
+		}
+		r.Elem = ft
+		data[item.Name] = r
+	}
+	relCache.Store(t, data)
+	return data, nil
+}
+
+//preload 标记查询后加载的关联字段
+type preload struct {
+	Table
+	names []string
+}
+
+// Preload 包装 tbl，Select/SelectScan 查询后按关联字段的 rel tag 加载子表，每个关联一次 IN 查询
+// 支持用 . 加载多层关联，可与 Unscoped 嵌套使用
+//
+//	mysql.Select(ctx, db, mysql.Preload(&Order{}, "Items", "Items.Product"), builder)
+func Preload(tbl Table, names ...string) Table {
+	return preload{Table: tbl, names: names}
+}
+
+//preloadNames 取出 Preload 包装中的关联字段
+func preloadNames(tbl Table) []string {
+	var names []string
+	for {
+		switch t := tbl.(type) {
+		case preload:
+			names = append(names, t.names...)
+			tbl = t.Table
+		case unscoped:
+			tbl = t.Table
+		case cached:
+			tbl = t.Table
+		default:
+			return names
+		}
+	}
+}
+
+//loadRelations 加载 parents 的关联字段，parents 为可寻址的父表结构体
+func loadRelations(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, parents []reflect.Value, names []string) error {
+	if len(parents) == 0 || len(names) == 0 {
+		return nil
+	}
+	rels, err := relations(tbl)
+	if err != nil {
+		return err
+	}
+	//按第一层分组，剩余部分交给子表继续加载
+	var order []string
+	nested := make(map[string][]string)
+	for _, name := range names {
+		first, rest := name, ""
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			first, rest = name[:i], name[i+1:]
+		}
+		if _, ok := nested[first]; !ok {
+			order = append(order, first)
+			nested[first] = nil
+		}
+		if rest != "" {
+			nested[first] = append(nested[first], rest)
+		}
+	}
+	fields := getField(tbl)
+	for _, name := range order {
+		r, ok := rels[name]
+		if !ok {
+			return fmt.Errorf("%s has no relation %s", tbl.TableName(), name)
+		}
+		if err := loadRelation(ctx, runner, fields[r.Ref], r, parents, nested[name]); err != nil {
+			return fmt.Errorf("preload %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+//preloadChunk 每次 IN 查询的最大 key 数
+const preloadChunk = 1000
+
+func loadRelation(ctx ctx.BaseContext, runner sq.BaseRunner, ref FiledInfo, r relation, parents []reflect.Value, nested []string) error {
+	keys := make([]interface{}, 0, len(parents))
+	seen := make(map[string]bool, len(parents))
+	for _, p := range parents {
+		v, k, ok := relationKey(p.FieldByIndex(ref.Index))
+		if ok && !seen[k] {
+			seen[k] = true
+			keys = append(keys, v)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	child := reflect.New(r.Elem).Interface().(Table)
+	fk, ok := getField(child)[r.FK]
+	if !ok {
+		return fmt.Errorf("%s has no column %s", child.TableName(), r.FK)
+	}
+	var tbl Table = child
+	if len(nested) > 0 {
+		tbl = Preload(child, nested...)
+	}
+	group := make(map[string][]reflect.Value, len(keys))
+	for begin := 0; begin < len(keys); begin += preloadChunk {
+		end := begin + preloadChunk
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunk := keys[begin:end]
+		rows, err := Select(ctx, runner, tbl, func(tblName string) sq.SelectBuilder {
+			return sq.Select(Field(child)...).From(tblName).Where(sq.Eq{r.FK: chunk})
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			v := reflect.ValueOf(row)
+			if _, k, ok := relationKey(v.Elem().FieldByIndex(fk.Index)); ok {
+				group[k] = append(group[k], v)
+			}
+		}
+	}
+	for _, p := range parents {
+		var list []reflect.Value
+		if _, k, ok := relationKey(p.FieldByIndex(ref.Index)); ok {
+			list = group[k]
+		}
+		field := p.FieldByIndex(r.Index)
+		if r.Kind == RelHasOne {
+			if len(list) > 0 {
+				field.Set(elemValue(list[0], r.Ptr))
+			}
+			continue
+		}
+		s := reflect.MakeSlice(field.Type(), 0, len(list))
+		for _, v := range list {
+			s = reflect.Append(s, elemValue(v, r.Ptr))
+		}
+		field.Set(s)
+	}
+	return nil
+}
+
+//relationKey 关联列的值和用于匹配的 key，指针取其指向的值，sql.NullInt64 等取 Value()
+//整数统一为 int64，父表和子表的列类型不同时也能匹配，值为 NULL 时 ok 为 false
+func relationKey(v reflect.Value) (interface{}, string, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, "", false
+		}
+		v = v.Elem()
+	}
+	val := v.Interface()
+	if valuer, ok := val.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		if err != nil || dv == nil {
+			return nil, "", false
+		}
+		val = dv
+	}
+	if n, ok := toInt64(val); ok {
+		val = n
+	}
+	if b, ok := val.([]byte); ok {
+		val = string(b)
+	}
+	return val, fmt.Sprintf("%T:%v", val, val), true
+}
+
+//elemValue v 为子表结构体指针，ptr 为 false 时取值
+func elemValue(v reflect.Value, ptr bool) reflect.Value {
+	if ptr {
+		return v
+	}
+	return v.Elem()
+}
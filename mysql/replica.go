@@ -0,0 +1,277 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/582033/gin-utils/apm"
+	ctx2 "github.com/582033/gin-utils/ctx"
+	"github.com/582033/gin-utils/log"
+)
+
+const (
+	//BalanceRoundRobin 轮询
+	BalanceRoundRobin = "round_robin"
+	//BalanceWeighted 按权重平滑轮询
+	BalanceWeighted = "weighted"
+
+	//PrimaryContextKey context 中存在该 key 且为 true 时读请求走主库
+	PrimaryContextKey = "_mysql_ctx_key_primary"
+)
+
+const replicaCheckTick = 3 * time.Second
+
+type replica struct {
+	name    string
+	db      *sql.DB
+	weight  int
+	current int
+	healthy int32
+	//复制延迟 秒，-1 表示未知
+	lag int64
+}
+
+type replicaSet struct {
+	list    []*replica
+	balance string
+	maxLag  int64
+	next    uint64
+	mu      sync.Mutex
+}
+
+// ForcePrimary 标记当前请求后续的读都走主库，用于写后立即读
+func ForcePrimary(c ctx2.BaseContext) {
+	c.Set(PrimaryContextKey, true)
+}
+
+// WithPrimary 返回一个读请求走主库的 context
+func WithPrimary(c context.Context) context.Context {
+	return context.WithValue(c, PrimaryContextKey, true)
+}
+
+func usePrimary(c context.Context) bool {
+	if c == nil {
+		return false
+	}
+	v, _ := c.Value(PrimaryContextKey).(bool)
+	return v
+}
+
+// inherit 从库未配置的连接参数沿用主库配置
+func (v Conf) inherit(primary *Conf) *Conf {
+	if v.Username == "" {
+		v.Username = primary.Username
+		v.Password = primary.Password
+	}
+	if v.DBName == "" {
+		v.DBName = primary.DBName
+	}
+	if v.Port == 0 {
+		v.Port = primary.Port
+	}
+	if v.Charset == "" {
+		v.Charset = primary.Charset
+	}
+	if v.Timeout == 0 {
+		v.Timeout = primary.Timeout
+	}
+	if v.MaxOpenConns == 0 {
+		v.MaxOpenConns = primary.MaxOpenConns
+	}
+	if v.MaxIdleConns == 0 {
+		v.MaxIdleConns = primary.MaxIdleConns
+	}
+	if v.Loc == "" {
+		v.Loc = primary.Loc
+	}
+	if v.ConnMaxLifetime == 0 {
+		v.ConnMaxLifetime = primary.ConnMaxLifetime
+	}
+	if v.ConnMaxIdleTime == 0 {
+		v.ConnMaxIdleTime = primary.ConnMaxIdleTime
+	}
+	if v.TLS == "" && v.TLSConfig == nil {
+		v.TLS, v.TLSConfig = primary.TLS, primary.TLSConfig
+	}
+	if v.Params == nil {
+		v.Params = primary.Params
+	}
+	if v.Weight <= 0 {
+		v.Weight = 1
+	}
+	v.Replicas = nil
+	return &v
+}
+
+// newReplicaSet 使用主库的驱动打开从库连接，从库配置了 dsn 时直接使用
+// 连接失败的从库标记为不可用，由后台检查恢复
+func newReplicaSet(driverName string, conf *Conf) (*replicaSet, error) {
+	set := &replicaSet{
+		balance: conf.Balance,
+		maxLag:  int64(conf.MaxLag),
+	}
+	for _, item := range conf.Replicas {
+		rc := item.inherit(conf)
+		if err := rc.registerTLS(); err != nil {
+			return nil, err
+		}
+		dsn := rc.DSN
+		if dsn == "" {
+			dsn = rc.String()
+		}
+		db, err := sql.Open(driverName, dsn)
+		if err != nil {
+			return nil, err
+		}
+		if err := rc.setPool(db); err != nil {
+			db.Close()
+			return nil, err
+		}
+		r := &replica{
+			name:   rc.Host + ":" + strconv.Itoa(int(rc.Port)),
+			db:     db,
+			weight: rc.Weight,
+			lag:    -1,
+		}
+		set.list = append(set.list, r)
+	}
+	set.checkOnce()
+	go set.check()
+	return set, nil
+}
+
+// pick 选择一个健康且延迟在阈值内的从库，没有可用从库时返回 nil
+func (s *replicaSet) pick() *sql.DB {
+	available := make([]*replica, 0, len(s.list))
+	for _, r := range s.list {
+		if atomic.LoadInt32(&r.healthy) == 0 {
+			continue
+		}
+		lag := atomic.LoadInt64(&r.lag)
+		if s.maxLag > 0 && (lag < 0 || lag > s.maxLag) {
+			continue
+		}
+		available = append(available, r)
+	}
+	if len(available) == 0 {
+		return nil
+	}
+	if s.balance != BalanceWeighted {
+		n := atomic.AddUint64(&s.next, 1)
+		return available[int(n%uint64(len(available)))].db
+	}
+	//平滑加权轮询
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var best *replica
+	total := 0
+	for _, r := range available {
+		r.current += r.weight
+		total += r.weight
+		if best == nil || r.current > best.current {
+			best = r
+		}
+	}
+	best.current -= total
+	return best.db
+}
+
+func (s *replicaSet) check() {
+	for range time.Tick(replicaCheckTick) {
+		s.checkOnce()
+	}
+}
+
+func (s *replicaSet) checkOnce() {
+	for _, r := range s.list {
+		if err := r.db.Ping(); err != nil {
+			if atomic.SwapInt32(&r.healthy, 0) == 1 {
+				log.Errorf("mysql replica %s unavailable: %s", r.name, err.Error())
+			}
+			continue
+		}
+		if atomic.SwapInt32(&r.healthy, 1) == 0 {
+			log.Infof("mysql replica %s available", r.name)
+		}
+		atomic.StoreInt64(&r.lag, replicaLag(r.db))
+	}
+}
+
+// replicaLag 查询复制延迟 秒，无法获取时返回 -1
+func replicaLag(db *sql.DB) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTick)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		rows, err = db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	}
+	if err != nil {
+		log.Debugf("mysql replica status error: %s", err.Error())
+		return -1
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil || !rows.Next() {
+		//不是从库
+		return 0
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return -1
+	}
+	for i, name := range columns {
+		if name == "Seconds_Behind_Source" || name == "Seconds_Behind_Master" {
+			if values[i] == nil {
+				//复制线程未运行
+				return -1
+			}
+			lag, err := strconv.ParseInt(string(values[i]), 10, 64)
+			if err != nil {
+				return -1
+			}
+			return lag
+		}
+	}
+	return -1
+}
+
+func (s *replicaSet) stats(key string) {
+	for _, r := range s.list {
+		k := key + "/replica/" + r.name
+		stats := r.db.Stats()
+		apm.Gauges(k, "InUse").Update(int64(stats.InUse))
+		apm.Gauges(k, "OpenConnections").Update(int64(stats.OpenConnections))
+		apm.Gauges(k, "WaitCount").Update(stats.WaitCount)
+		apm.Gauges(k, "Lag").Update(atomic.LoadInt64(&r.lag))
+		apm.Gauges(k, "Healthy").Update(int64(atomic.LoadInt32(&r.healthy)))
+	}
+}
+
+// reader 读请求使用的连接，未配置从库、要求读主库或从库不可用时返回主库
+func (dbConn *DBConn) reader(c context.Context) *sql.DB {
+	if dbConn.replicas == nil || usePrimary(c) {
+		return dbConn.db
+	}
+	if db := dbConn.replicas.pick(); db != nil {
+		return db
+	}
+	return dbConn.db
+}
+
+// afterWrite 开启 sticky_primary 时，写成功后当前请求的读都走主库
+func (dbConn *DBConn) afterWrite(c context.Context) {
+	if dbConn.replicas == nil || !dbConn.sticky {
+		return
+	}
+	if s, ok := c.(interface{ Set(string, interface{}) }); ok {
+		s.Set(PrimaryContextKey, true)
+	}
+}
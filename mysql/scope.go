@@ -0,0 +1,237 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/582033/gin-utils/ctx"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lann/builder"
+)
+
+const (
+	//OptCreated 插入时自动填充当前时间
+	OptCreated = "created"
+	//OptUpdated 插入和更新时自动填充当前时间
+	OptUpdated = "updated"
+	//OptSoftDelete 软删除列，为 NULL(*time.Time、sql.NullTime) 或 0(整数类型) 表示未删除
+	//time.Time 无法表示 NULL，不能作为软删除列
+	OptSoftDelete = "softdelete"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+var nullTimeType = reflect.TypeOf(sql.NullTime{})
+
+//unscoped 标记查询不附加软删除等默认条件
+type unscoped struct {
+	Table
+}
+
+// Unscoped 包装 tbl，Select/SelectScan 返回包括已软删除的记录，DeleteByPK 执行物理删除
+//
+//	mysql.Select(ctx, db, mysql.Unscoped(&Order{}), builder)
+func Unscoped(tbl Table) Table {
+	return unscoped{Table: tbl}
+}
+
+//unwrap 去掉 Unscoped、Preload、Cached 包装，返回原始 tbl 和是否附加默认条件
+func unwrap(tbl Table) (Table, bool) {
+	scoped := true
+	for {
+		switch t := tbl.(type) {
+		case unscoped:
+			tbl, scoped = t.Table, false
+		case preload:
+			tbl = t.Table
+		case cached:
+			tbl = t.Table
+		default:
+			return tbl, scoped
+		}
+	}
+}
+
+//findOpt 获取设置了某个 tag 选项的字段
+func findOpt(tbl Table, opt string) (FiledInfo, bool) {
+	for _, f := range getField(tbl) {
+		if f.Has(opt) {
+			return f, true
+		}
+	}
+	return FiledInfo{}, false
+}
+
+//softDeleteField 获取软删除字段并检查类型
+func softDeleteField(tbl Table) (FiledInfo, bool, error) {
+	f, ok := findOpt(tbl, OptSoftDelete)
+	if !ok {
+		return f, false, nil
+	}
+	t := fieldType(tbl, f)
+	if t == nullTimeType || (t.Kind() == reflect.Ptr && t.Elem() == timeType) || isIntKind(t.Kind()) {
+		return f, true, nil
+	}
+	return f, false, fmt.Errorf("%s.%s: softdelete column must be *time.Time, sql.NullTime or integer, got %s", tbl.TableName(), f.Tag, t)
+}
+
+//fieldType 字段的类型
+func fieldType(tbl Table, f FiledInfo) reflect.Type {
+	return reflect.Indirect(reflect.New(getType(tbl))).FieldByIndex(f.Index).Type()
+}
+
+//prepareSelect 生成查询语句，附加软删除和租户条件
+//条件以 AND 追加，字符串条件中的 OR 需要自行加括号或使用 sq.Or
+func prepareSelect(ctx ctx.BaseContext, tbl Table, selectBuilder func(tblName string) sq.SelectBuilder) (Table, sq.SelectBuilder, error) {
+	tbl, scoped := unwrap(tbl)
+	b := selectBuilder(tbl.TableName())
+	if scoped {
+		f, ok, err := softDeleteField(tbl)
+		if err != nil {
+			return tbl, b, err
+		}
+		if ok {
+			b = b.Where(notDeleted(tbl, f))
+		}
+	}
+	where, err := tenantWhere(ctx, tbl)
+	if err != nil {
+		return tbl, b, err
+	}
+	if where != nil {
+		b = b.Where(where)
+	}
+	return tbl, b, nil
+}
+
+//notDeleted 未删除条件
+func notDeleted(tbl Table, f FiledInfo) sq.Sqlizer {
+	if isIntKind(fieldType(tbl, f).Kind()) {
+		return sq.Eq{f.Tag: 0}
+	}
+	return sq.Eq{f.Tag: nil}
+}
+
+func isIntKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+//timeValue 按字段类型生成写入的时间值，整数类型为 unix 秒
+func timeValue(t reflect.Type, now time.Time) interface{} {
+	if isIntKind(t.Kind()) {
+		return now.Unix()
+	}
+	return now
+}
+
+//setTime 将当前时间写入字段，支持 time.Time、*time.Time、sql.NullTime 和整数
+func setTime(v reflect.Value, now time.Time) {
+	switch {
+	case v.Type() == timeType:
+		v.Set(reflect.ValueOf(now))
+	case v.Kind() == reflect.Ptr && v.Type().Elem() == timeType:
+		v.Set(reflect.ValueOf(&now))
+	case v.Type() == nullTimeType:
+		v.Set(reflect.ValueOf(sql.NullTime{Time: now, Valid: true}))
+	case isIntKind(v.Kind()):
+		if v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64 {
+			v.SetUint(uint64(now.Unix()))
+		} else {
+			v.SetInt(now.Unix())
+		}
+	}
+}
+
+//touchCreated 插入前填充 created/updated 字段，已有值的 created 字段保持不变
+func touchCreated(list []Row) {
+	fields := getField(list[0])
+	now := time.Now()
+	for _, row := range list {
+		v := reflect.ValueOf(row)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			continue
+		}
+		v = v.Elem()
+		for _, f := range fields {
+			fv := v.FieldByIndex(f.Index)
+			if f.Has(OptUpdated) || (f.Has(OptCreated) && fv.IsZero()) {
+				setTime(fv, now)
+			}
+		}
+	}
+}
+
+//touchUpdated 更新语句附加 updated 字段，调用方已设置该列时不再重复设置
+func touchUpdated(tbl Table, b sq.UpdateBuilder) sq.UpdateBuilder {
+	if f, ok := findOpt(tbl, OptUpdated); ok && !setsColumn(b, f.Tag) {
+		b = b.Set(f.Tag, timeValue(fieldType(tbl, f), time.Now()))
+	}
+	return b
+}
+
+//setsColumn 更新语句的 SET 中是否已有该列，setClause 未导出，通过反射读取列名
+func setsColumn(b sq.UpdateBuilder, column string) bool {
+	clauses, ok := builder.Get(b, "SetClauses")
+	if !ok {
+		return false
+	}
+	v := reflect.ValueOf(clauses)
+	if v.Kind() != reflect.Slice {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		item := reflect.Indirect(v.Index(i))
+		if item.Kind() != reflect.Struct {
+			continue
+		}
+		if c := item.FieldByName("column"); c.Kind() == reflect.String && c.String() == column {
+			return true
+		}
+	}
+	return false
+}
+
+// SoftDelete 软删除，将 softdelete 列设置为当前时间，updateBuilder 中只需要写条件
+//
+//	mysql.SoftDelete(ctx, db, &Order{}, func(tblName string) sq.UpdateBuilder {
+//		return sq.Update(tblName).Where(sq.Eq{"id": id})
+//	})
+func SoftDelete(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, updateBuilder func(tblName string) sq.UpdateBuilder) (count int64, err error) {
+	tbl, _ = unwrap(tbl)
+	f, ok, err := softDeleteField(tbl)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("%s has no softdelete column", tbl.TableName())
+	}
+	return Update(ctx, runner, tbl, func(tblName string) sq.UpdateBuilder {
+		return updateBuilder(tblName).Set(f.Tag, timeValue(fieldType(tbl, f), time.Now())).Where(notDeleted(tbl, f))
+	})
+}
+
+// Restore 恢复软删除的记录，updateBuilder 中只需要写条件
+func Restore(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, updateBuilder func(tblName string) sq.UpdateBuilder) (count int64, err error) {
+	tbl, _ = unwrap(tbl)
+	f, ok, err := softDeleteField(tbl)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("%s has no softdelete column", tbl.TableName())
+	}
+	var value interface{}
+	if isIntKind(fieldType(tbl, f).Kind()) {
+		value = 0
+	}
+	return Update(ctx, runner, tbl, func(tblName string) sq.UpdateBuilder {
+		return updateBuilder(tblName).Set(f.Tag, value)
+	})
+}
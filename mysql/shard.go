@@ -0,0 +1,385 @@
+package mysql
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/582033/gin-utils/config"
+	"github.com/582033/gin-utils/ctx"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	//ShardHash 整数取模，字符串按 crc32 取模
+	ShardHash = "hash"
+	//ShardRange 按 ranges 划分的区间
+	ShardRange = "range"
+)
+
+// ShardFunc 自定义分片函数，返回分表下标
+type ShardFunc func(key interface{}) (int, error)
+
+// ShardRule 分片规则，配置在 mysql_shard.<逻辑表名> 下，也可以通过 RegisterShard 在代码中声明
+//
+//	"mysql_shard": {
+//		"orders": {"key": "user_id", "tables": 64, "databases": 2, "dbs": ["order0", "order1"]}
+//	}
+//
+// 分表 i 所在的库为 i / ceil(tables / databases)，即 orders_00..orders_31 在 order0，orders_32..orders_63 在 order1
+type ShardRule struct {
+	//分片列
+	Key string `json:"key"`
+	//hash(默认) 或 range
+	Algorithm string `json:"algorithm"`
+	//分表数量
+	Tables int `json:"tables"`
+	//分表名格式，参数为逻辑表名和分表下标，默认 %s_%02d
+	TableFormat string `json:"table_format"`
+	//分库数量，默认为 dbs 的数量
+	Databases int `json:"databases"`
+	//每个分库对应的 mysql 配置 key，只有一个时所有分库使用同一个连接
+	DBs []string `json:"dbs"`
+	//库名格式，参数为分库下标，如 order_%d，设置后表名为 order_0.orders_00，用于同一个连接下的多个库
+	DBFormat string `json:"db_format"`
+	//range 算法的区间下界，升序，key >= ranges[i] 且 < ranges[i+1] 时使用分表 i
+	Ranges []int64 `json:"ranges"`
+	//自定义分片函数，优先于 algorithm
+	Func ShardFunc `json:"-"`
+}
+
+// Shard 路由结果
+type Shard struct {
+	DB *DBConn
+	//分表名，设置 db_format 时包含库名
+	Table string
+	Index int
+}
+
+var shardRules = struct {
+	sync.RWMutex
+	once sync.Once
+	m    map[string]*ShardRule
+}{m: make(map[string]*ShardRule)}
+
+// RegisterShard 在代码中声明逻辑表的分片规则，会覆盖配置
+func RegisterShard(logical string, rule *ShardRule) {
+	loadShardRules()
+	shardRules.Lock()
+	defer shardRules.Unlock()
+	shardRules.m[logical] = rule
+}
+
+//loadShardRules 读取 mysql_shard 配置
+func loadShardRules() {
+	shardRules.once.Do(func() {
+		var data map[string]*ShardRule
+		if err := config.Get("mysql_shard").Scan(&data); err != nil {
+			return
+		}
+		shardRules.Lock()
+		defer shardRules.Unlock()
+		for k, v := range data {
+			if _, ok := shardRules.m[k]; !ok {
+				shardRules.m[k] = v
+			}
+		}
+	})
+}
+
+//shardRule tbl 对应的分片规则
+func shardRule(tbl Table) (string, *ShardRule, error) {
+	loadShardRules()
+	tbl, _ = unwrap(tbl)
+	logical := tbl.TableName()
+	shardRules.RLock()
+	rule, ok := shardRules.m[logical]
+	shardRules.RUnlock()
+	if !ok {
+		return "", nil, fmt.Errorf("%s has no shard rule", logical)
+	}
+	if rule.Tables <= 0 {
+		return "", nil, fmt.Errorf("%s shard rule: tables must be positive", logical)
+	}
+	if len(rule.DBs) == 0 {
+		return "", nil, fmt.Errorf("%s shard rule: dbs is empty", logical)
+	}
+	return logical, rule, nil
+}
+
+func (r *ShardRule) databases() int {
+	if r.Databases > 0 {
+		return r.Databases
+	}
+	return len(r.DBs)
+}
+
+//index 计算分表下标，结果不在 [0, tables) 内时报错
+func (r *ShardRule) index(key interface{}) (int, error) {
+	i, err := r.rawIndex(key)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 || i >= r.Tables {
+		return 0, fmt.Errorf("shard index %d of key %v is out of range [0, %d)", i, key, r.Tables)
+	}
+	return i, nil
+}
+
+func (r *ShardRule) rawIndex(key interface{}) (int, error) {
+	if r.Func != nil {
+		return r.Func(key)
+	}
+	switch r.Algorithm {
+	case "", ShardHash:
+		//负数按补码转为无符号数取模，避免取反溢出
+		if n, ok := toUint64(key); ok {
+			return int(n % uint64(r.Tables)), nil
+		}
+		var b []byte
+		switch v := key.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		default:
+			return 0, fmt.Errorf("unsupported shard key type %T", key)
+		}
+		return int(crc32.ChecksumIEEE(b) % uint32(r.Tables)), nil
+	case ShardRange:
+		n, ok := toInt64(key)
+		if !ok {
+			return 0, fmt.Errorf("range shard key must be integer within int64, got %T %v", key, key)
+		}
+		i := sort.Search(len(r.Ranges), func(i int) bool {
+			return r.Ranges[i] > n
+		}) - 1
+		if i < 0 || i >= r.Tables {
+			return 0, fmt.Errorf("shard key %d is out of range", n)
+		}
+		return i, nil
+	}
+	return 0, fmt.Errorf("unknown shard algorithm %s", r.Algorithm)
+}
+
+//shard 分表下标对应的连接和表名
+func (r *ShardRule) shard(logical string, i int) (*Shard, error) {
+	per := (r.Tables + r.databases() - 1) / r.databases()
+	dbIndex := i / per
+	key := r.DBs[0]
+	if len(r.DBs) > 1 {
+		if dbIndex >= len(r.DBs) {
+			return nil, fmt.Errorf("%s shard rule: no db for database %d", logical, dbIndex)
+		}
+		key = r.DBs[dbIndex]
+	}
+	db := DB(key)
+	if db == nil {
+		return nil, fmt.Errorf("mysql %s not found", key)
+	}
+	format := r.TableFormat
+	if format == "" {
+		format = "%s_%02d"
+	}
+	name := fmt.Sprintf(format, logical, i)
+	if r.DBFormat != "" {
+		name = fmt.Sprintf(r.DBFormat, dbIndex) + "." + name
+	}
+	return &Shard{DB: db, Table: name, Index: i}, nil
+}
+
+// Route 按分片列的值计算连接和分表名，可配合 Tx 使用 shard.Table 自行拼接语句
+func Route(tbl Table, key interface{}) (*Shard, error) {
+	logical, rule, err := shardRule(tbl)
+	if err != nil {
+		return nil, err
+	}
+	i, err := rule.index(key)
+	if err != nil {
+		return nil, err
+	}
+	return rule.shard(logical, i)
+}
+
+// Shards 所有分片
+func Shards(tbl Table) ([]*Shard, error) {
+	logical, rule, err := shardRule(tbl)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*Shard, 0, rule.Tables)
+	for i := 0; i < rule.Tables; i++ {
+		s, err := rule.shard(logical, i)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// ShardSelect 按分片列的值路由查询，selectBuilder 收到的是分表名
+func ShardSelect(ctx ctx.BaseContext, tbl Table, key interface{}, selectBuilder func(tblName string) sq.SelectBuilder) ([]Row, error) {
+	s, err := Route(tbl, key)
+	if err != nil {
+		return nil, err
+	}
+	return Select(ctx, s.DB, tbl, func(string) sq.SelectBuilder {
+		return selectBuilder(s.Table)
+	})
+}
+
+// ShardSelectOne 按分片列的值路由查询一条，没有数据时返回 sql.ErrNoRows
+func ShardSelectOne(ctx ctx.BaseContext, tbl Table, key interface{}, selectBuilder func(tblName string) sq.SelectBuilder) (Row, error) {
+	s, err := Route(tbl, key)
+	if err != nil {
+		return nil, err
+	}
+	return SelectOne(ctx, s.DB, tbl, func(string) sq.SelectBuilder {
+		return selectBuilder(s.Table)
+	})
+}
+
+// ShardScatter 没有分片列时并发查询所有分片并合并结果，每个库的并发数不超过其 max_open_conns
+// 排序和 limit 只在单个分片内生效，需要时自行对结果排序截断
+func ShardScatter(ctx ctx.BaseContext, tbl Table, selectBuilder func(tblName string) sq.SelectBuilder) ([]Row, error) {
+	shards, err := Shards(tbl)
+	if err != nil {
+		return nil, err
+	}
+	results := make([][]Row, len(shards))
+	errs := make([]error, len(shards))
+	sems := make(map[*DBConn]chan struct{})
+	for _, s := range shards {
+		if _, ok := sems[s.DB]; !ok {
+			sems[s.DB] = make(chan struct{}, scatterLimit(s.DB, len(shards)))
+		}
+	}
+	var wg sync.WaitGroup
+	for i, s := range shards {
+		wg.Add(1)
+		go func(i int, s *Shard) {
+			defer wg.Done()
+			sem := sems[s.DB]
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = Select(ctx, s.DB, tbl, func(string) sq.SelectBuilder {
+				return selectBuilder(s.Table)
+			})
+		}(i, s)
+	}
+	wg.Wait()
+	var list []Row
+	for i := range shards {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("shard %s: %w", shards[i].Table, errs[i])
+		}
+		list = append(list, results[i]...)
+	}
+	return list, nil
+}
+
+//scatterLimit 单个库的并发查询数，默认为连接池上限，未限制时为分片数
+func scatterLimit(db *DBConn, shards int) int {
+	if n := db.db.Stats().MaxOpenConnections; n > 0 && n < shards {
+		return n
+	}
+	return shards
+}
+
+// ShardInsert 按每行分片列的值路由写入，同一分表的行批量写入，会回写自增 ID
+func ShardInsert(ctx ctx.BaseContext, list ...Row) (count int64, err error) {
+	if len(list) == 0 {
+		return 0, nil
+	}
+	_, rule, err := shardRule(list[0])
+	if err != nil {
+		return 0, err
+	}
+	f, ok := getField(list[0])[rule.Key]
+	if !ok {
+		return 0, fmt.Errorf("%s has no shard key column %s", list[0].TableName(), rule.Key)
+	}
+	groups := make(map[string][]Row)
+	shards := make(map[string]*Shard)
+	var order []string
+	for _, row := range list {
+		s, err := Route(row, reflect.Indirect(reflect.ValueOf(row)).FieldByIndex(f.Index).Interface())
+		if err != nil {
+			return count, err
+		}
+		id := s.DB.name + "/" + s.Table
+		if _, ok := groups[id]; !ok {
+			order = append(order, id)
+			shards[id] = s
+		}
+		groups[id] = append(groups[id], row)
+	}
+	for _, id := range order {
+		rows, s := groups[id], shards[id]
+		for begin := 0; begin < len(rows); begin += 100 {
+			end := begin + 100
+			if end > len(rows) {
+				end = len(rows)
+			}
+			_, c, err := insertMany(ctx, s.DB, s.Table, rows[begin:end]...)
+			if err != nil {
+				return count, err
+			}
+			count += c
+		}
+	}
+	return count, nil
+}
+
+// ShardUpdate 按分片列的值路由更新，updateBuilder 收到的是分表名
+func ShardUpdate(ctx ctx.BaseContext, tbl Table, key interface{}, updateBuilder func(tblName string) sq.UpdateBuilder) (count int64, err error) {
+	s, err := Route(tbl, key)
+	if err != nil {
+		return 0, err
+	}
+	return Update(ctx, s.DB, tbl, func(string) sq.UpdateBuilder {
+		return updateBuilder(s.Table)
+	})
+}
+
+// ShardDelete 按分片列的值路由删除，deleteBuilder 收到的是分表名
+func ShardDelete(ctx ctx.BaseContext, tbl Table, key interface{}, deleteBuilder func(tblName string) sq.DeleteBuilder) (count int64, err error) {
+	s, err := Route(tbl, key)
+	if err != nil {
+		return 0, err
+	}
+	return Delete(ctx, s.DB, tbl, func(string) sq.DeleteBuilder {
+		return deleteBuilder(s.Table)
+	})
+}
+
+//toUint64 整数类型的分片列转为 uint64，有符号数按补码转换
+func toUint64(key interface{}) (uint64, bool) {
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), true
+	}
+	return 0, false
+}
+
+//toInt64 整数类型的分片列转为 int64，超过 int64 范围的无符号数 ok 为 false
+func toInt64(key interface{}) (int64, bool) {
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n := v.Uint(); n <= math.MaxInt64 {
+			return int64(n), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,85 @@
+package mysql
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestToInt64(t *testing.T) {
+	tests := []struct {
+		key  interface{}
+		want int64
+		ok   bool
+	}{
+		{int8(-3), -3, true},
+		{int64(math.MinInt64), math.MinInt64, true},
+		{uint32(7), 7, true},
+		{uint64(math.MaxInt64), math.MaxInt64, true},
+		{uint64(math.MaxInt64) + 1, 0, false},
+		{uint64(math.MaxUint64), 0, false},
+		{"7", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := toInt64(tt.key)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("toInt64(%T %v) = %d, %v, want %d, %v", tt.key, tt.key, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestShardIndex(t *testing.T) {
+	hash := &ShardRule{Tables: 4}
+	rng := &ShardRule{Algorithm: ShardRange, Tables: 2, Ranges: []int64{0, 100}}
+	tests := []struct {
+		rule    *ShardRule
+		key     interface{}
+		want    int
+		wantErr bool
+	}{
+		{hash, 6, 2, false},
+		{hash, int64(-1), int(uint64(math.MaxUint64) % 4), false},
+		{hash, int64(math.MinInt64), 0, false},
+		{hash, uint64(math.MaxUint64), 3, false},
+		{hash, 1.5, 0, true},
+		{rng, 50, 0, false},
+		{rng, uint64(150), 1, false},
+		{rng, -1, 0, true},
+		//超过 int64 的无符号数不能截断后落入某个区间
+		{rng, uint64(math.MaxUint64), 0, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.rule.index(tt.key)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("index(%T %v) = %d, %v, want %d, err %v", tt.key, tt.key, got, err, tt.want, tt.wantErr)
+		}
+	}
+	custom := &ShardRule{Tables: 2, Func: func(interface{}) (int, error) { return 5, nil }}
+	if _, err := custom.index(1); err == nil {
+		t.Error("index out of range from Func: want error")
+	}
+}
+
+func TestRelationKeyUnsigned(t *testing.T) {
+	big := uint64(math.MaxUint64)
+	val, key, ok := relationKey(reflect.ValueOf(&big))
+	if !ok || val != big || key != "uint64:18446744073709551615" {
+		t.Fatalf("relationKey(MaxUint64) = %v, %q, %v", val, key, ok)
+	}
+	_, small, _ := relationKey(reflect.ValueOf(uint32(5)))
+	_, signed, _ := relationKey(reflect.ValueOf(int64(5)))
+	if small != signed {
+		t.Fatalf("relationKey(uint32 5) = %q, relationKey(int64 5) = %q", small, signed)
+	}
+}
+
+func TestScatterLimit(t *testing.T) {
+	db := newTestDB(t)
+	if n := scatterLimit(db, 1024); n != 1 {
+		t.Fatalf("scatterLimit with max_open_conns 1 = %d, want 1", n)
+	}
+	db.db.SetMaxOpenConns(0)
+	if n := scatterLimit(db, 16); n != 16 {
+		t.Fatalf("scatterLimit without pool limit = %d, want 16", n)
+	}
+}
@@ -0,0 +1,161 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/582033/gin-utils/apm"
+	ctx2 "github.com/582033/gin-utils/ctx"
+	"github.com/582033/gin-utils/log"
+)
+
+//默认慢查询阈值
+const defaultSlowThreshold = time.Second
+
+var (
+	inListRe = regexp.MustCompile(`(?i)\bin\s*\(\s*\?(\s*,\s*\?)*\s*\)`)
+	valuesRe = regexp.MustCompile(`(?i)\bvalues\s*\(\s*\?(\s*,\s*\?)*\s*\)(\s*,\s*\(\s*\?(\s*,\s*\?)*\s*\))*`)
+	spaceRe  = regexp.MustCompile(`\s+`)
+)
+
+// Fingerprint 归一化 SQL，字面量替换为 ?，IN 列表和多行 VALUES 合并，用于按语句聚合统计
+//
+//	SELECT * FROM t WHERE id IN (1, 2, 3) AND name = 'a'  =>  select * from t where id in (?+) and name = ?
+func Fingerprint(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			//字符串字面量
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' {
+					i++
+					continue
+				}
+				if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			b.WriteByte('?')
+		case c == '`':
+			//标识符原样保留
+			j := strings.IndexByte(query[i+1:], '`')
+			if j < 0 {
+				b.WriteString(query[i:])
+				i = len(query)
+				break
+			}
+			b.WriteString(query[i : i+j+2])
+			i += j + 1
+		case c == '-' && i+1 < len(query) && query[i+1] == '-', c == '#':
+			//单行注释
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			b.WriteByte(' ')
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			//多行注释
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 3
+			}
+			b.WriteByte(' ')
+		case c >= '0' && c <= '9' && (i == 0 || !isIdentByte(query[i-1])):
+			//数字字面量，包括 0x 开头和小数
+			for i+1 < len(query) && (isIdentByte(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	fp := strings.ToLower(strings.TrimSpace(spaceRe.ReplaceAllString(b.String(), " ")))
+	fp = inListRe.ReplaceAllString(fp, "in (?+)")
+	fp = valuesRe.ReplaceAllString(fp, "values (...)")
+	return fp
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+//slowThreshold 慢查询阈值，slow_threshold 为 0 时使用默认值，小于 0 时不记录
+func (v Conf) slowThreshold() time.Duration {
+	if v.SlowThreshold == 0 {
+		return defaultSlowThreshold
+	}
+	return time.Duration(v.SlowThreshold) * time.Millisecond
+}
+
+// SlowLogHook 慢查询日志，超过实例配置的 slow_threshold 时记录，explain_slow 开启时异步记录 SELECT 的执行计划
+type SlowLogHook struct{}
+
+func (SlowLogHook) Before(c context.Context, _ *QueryEvent) context.Context {
+	return c
+}
+
+func (SlowLogHook) After(c context.Context, e *QueryEvent) {
+	threshold := e.conn.slowThreshold
+	if threshold < 0 || e.Duration < threshold {
+		return
+	}
+	apm.Counter("mysql/"+e.Instance, "slow").Inc(1)
+	requestID := c.Value(ctx2.BaseContextRequestIDKey)
+	log.WithCtx(c).Warnf("[%+v] mysql slow query on %s: %s, fingerprint: %s, args: %+v, affected: %v, cost: %s",
+		requestID, e.Instance, e.Query, e.Fingerprint(), e.Args, e.RowsAffected, e.Duration)
+	if e.conn.explainSlow && e.db != nil && e.conn.Dialect().Name() != DialectSQLite && strings.HasPrefix(e.Fingerprint(), "select") {
+		//请求结束后 c 可能被复用，协程中只使用提前取出的请求 ID
+		rid, _ := requestID.(string)
+		go explain(rid, e.db, e.Query, e.Args)
+	}
+}
+
+// explain 异步记录慢查询的执行计划
+func explain(requestID string, db *sql.DB, query string, args []interface{}) {
+	c := ctx2.NewNilBaseContext()
+	c.SetRequestId(requestID)
+	ec, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := db.QueryContext(ec, "EXPLAIN "+query, args...)
+	if err != nil {
+		log.WithCtx(c).Warnf("mysql explain error: %s", err.Error())
+		return
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return
+	}
+	var plan []string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return
+		}
+		items := make([]string, 0, len(columns))
+		for i, name := range columns {
+			if values[i].Valid {
+				items = append(items, fmt.Sprintf("%s=%s", name, values[i].String))
+			}
+		}
+		plan = append(plan, strings.Join(items, " "))
+	}
+	log.WithCtx(c).Warnf("mysql slow query explain: %s\n%s", query, strings.Join(plan, "\n"))
+}
@@ -0,0 +1,31 @@
+package mysql
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"placeholder", "SELECT * FROM t WHERE id = ?", "select * from t where id = ?"},
+		{"numbers", "SELECT * FROM t2 WHERE c1 = 10 AND f = 1.5 AND h = 0x1F", "select * from t2 where c1 = ? and f = ? and h = ?"},
+		{"strings", `SELECT * FROM t WHERE a = 'x' AND b = "y"`, "select * from t where a = ? and b = ?"},
+		{"escaped quotes", `SELECT 'it''s', 'a\'b', "c\"d"`, "select ?, ?, ?"},
+		{"in list", "SELECT * FROM t WHERE id IN (1, 2, 3) AND name = 'a'", "select * from t where id in (?+) and name = ?"},
+		{"in placeholders", "SELECT * FROM t WHERE id in ( ?,? , ? )", "select * from t where id in (?+)"},
+		{"multi values", "INSERT INTO t (a, b) VALUES (1, 'x'), (2, 'y')", "insert into t (a, b) values (...)"},
+		{"values placeholders", "INSERT INTO t (a) VALUES (?),(?)", "insert into t (a) values (...)"},
+		{"whitespace", "  SELECT  *\n\tFROM t\r\n WHERE a=1  ", "select * from t where a=?"},
+		{"comments", "SELECT a -- note\nFROM t # more\nWHERE /* c */ b = 2", "select a from t where b = ?"},
+		{"backticks kept", "SELECT `col 1`, `x'y` FROM `t1`", "select `col 1`, `x'y` from `t1`"},
+		{"dollar placeholder", "SELECT * FROM t WHERE id = $1", "select * from t where id = $1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Fingerprint(tt.query); got != tt.want {
+				t.Fatalf("Fingerprint(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/582033/gin-utils/ctx"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Rows 逐行读取查询结果，不会一次加载到内存，使用完必须 Close
+//
+//	rows, err := mysql.Stream(ctx, db, &Order{}, builder)
+//	if err != nil {
+//		return err
+//	}
+//	defer rows.Close()
+//	for rows.Next() {
+//		order := rows.Row().(*Order)
+//	}
+//	return rows.Err()
+type Rows struct {
+	ctx  context.Context
+	rows *sql.Rows
+	t    reflect.Type
+	//结果列对应的字段，nil 表示结构体中没有该列
+	fields []*FiledInfo
+	cur    Row
+	err    error
+}
+
+// Stream 执行查询并返回逐行读取的迭代器
+func Stream(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, selectBuilder func(tblName string) sq.SelectBuilder) (*Rows, error) {
+	tbl, sb, err := prepareSelect(ctx, tbl, selectBuilder)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := sb.RunWith(runner).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	fields := getField(tbl)
+	list := make([]*FiledInfo, len(columns))
+	for i, c := range columns {
+		if f, ok := fields[c]; ok {
+			list[i] = &f
+		}
+	}
+	return &Rows{ctx: ctx, rows: rows, t: getType(tbl), fields: list}, nil
+}
+
+// Next 读取下一行，没有数据、出错或 ctx 取消时返回 false，通过 Err 获取错误
+func (r *Rows) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if err := r.ctx.Err(); err != nil {
+		r.err = err
+		return false
+	}
+	if !r.rows.Next() {
+		r.err = r.rows.Err()
+		return false
+	}
+	v := reflect.New(r.t)
+	dest := make([]interface{}, len(r.fields))
+	for i, f := range r.fields {
+		if f == nil {
+			var tmp interface{}
+			dest[i] = &tmp
+		} else {
+			dest[i] = f.scanDest(v.Elem().FieldByIndex(f.Index))
+		}
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		r.err = err
+		return false
+	}
+	r.cur = v.Interface().(Row)
+	return true
+}
+
+// Row 当前行，类型为 tbl 对应的结构体指针，每行都是新的对象
+func (r *Rows) Row() Row {
+	return r.cur
+}
+
+// Err 迭代过程中的错误
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Close 释放连接，可重复调用
+func (r *Rows) Close() error {
+	return r.rows.Close()
+}
+
+// Each 逐行查询并回调，fn 返回错误时停止
+func Each(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, selectBuilder func(tblName string) sq.SelectBuilder, fn func(row Row) error) error {
+	rows, err := Stream(ctx, runner, tbl, selectBuilder)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows.Row()); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// EachBatch 逐行查询，每 size 行回调一次，最后一批可能不足 size，fn 返回错误时停止
+func EachBatch(ctx ctx.BaseContext, runner sq.BaseRunner, tbl Table, selectBuilder func(tblName string) sq.SelectBuilder, size int, fn func(list []Row) error) error {
+	if size <= 0 {
+		return fmt.Errorf("batch size must be positive")
+	}
+	batch := make([]Row, 0, size)
+	err := Each(ctx, runner, tbl, selectBuilder, func(row Row) error {
+		batch = append(batch, row)
+		if len(batch) < size {
+			return nil
+		}
+		err := fn(batch)
+		batch = make([]Row, 0, size)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
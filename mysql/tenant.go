@@ -0,0 +1,149 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	ctx2 "github.com/582033/gin-utils/ctx"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	//OptTenant 租户列，Select/Update/Delete 自动附加 列 = 当前租户 条件，Insert/Upsert 自动填充
+	//
+	//	type Order struct {
+	//		ID       int64 `orm:"id,pk,auto"`
+	//		TenantID int64 `orm:"tenant_id,tenant"`
+	//	}
+	OptTenant = "tenant"
+
+	//CrossTenantContextKey context 中存在该 key 且为 true 时不附加租户条件
+	CrossTenantContextKey = "_mysql_ctx_key_cross_tenant"
+)
+
+// ErrNoTenant 租户表的语句执行时 context 中没有租户，需要先调用 SetTenant 或使用 CrossTenant
+var ErrNoTenant = errors.New("mysql: no tenant in context")
+
+// SetTenant 设置当前请求的租户，*ctx.Base 也可以直接调用 SetTenant
+func SetTenant(c ctx2.BaseContext, tenant string) {
+	c.Set(ctx2.BaseContextTenantKey, tenant)
+}
+
+// TenantOf 当前请求的租户，没有时为空
+func TenantOf(c ctx2.BaseContext) string {
+	if c == nil {
+		return ""
+	}
+	v, _ := c.Get(ctx2.BaseContextTenantKey)
+	s, _ := v.(string)
+	return s
+}
+
+// CrossTenant 在 fn 执行期间不附加租户条件，用于后台任务等需要跨租户读写的场景
+// 标记设置在 c 上，fn 执行期间不要在其他 goroutine 中使用 c 访问租户表
+//
+//	err := mysql.CrossTenant(ctx, func() error {
+//		list, err = mysql.Select(ctx, db, &Order{}, builder)
+//		return err
+//	})
+func CrossTenant(c ctx2.BaseContext, fn func() error) error {
+	prev, _ := c.Get(CrossTenantContextKey)
+	c.Set(CrossTenantContextKey, true)
+	defer c.Set(CrossTenantContextKey, prev)
+	return fn()
+}
+
+func crossTenant(c ctx2.BaseContext) bool {
+	if c == nil {
+		return false
+	}
+	v, _ := c.Get(CrossTenantContextKey)
+	b, _ := v.(bool)
+	return b
+}
+
+//tenantScope tbl 为租户表时返回租户列和当前租户，跨租户时 ok 为 false
+func tenantScope(c ctx2.BaseContext, tbl Table) (f FiledInfo, tenant string, ok bool, err error) {
+	f, ok = findOpt(tbl, OptTenant)
+	if !ok || crossTenant(c) {
+		return f, "", false, nil
+	}
+	tenant = TenantOf(c)
+	if tenant == "" {
+		return f, "", false, fmt.Errorf("%w: %s", ErrNoTenant, tbl.TableName())
+	}
+	return f, tenant, true, nil
+}
+
+//tenantWhere 租户表的租户条件，非租户表或跨租户时为 nil
+func tenantWhere(c ctx2.BaseContext, tbl Table) (sq.Sqlizer, error) {
+	f, tenant, ok, err := tenantScope(c, tbl)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return sq.Eq{f.Tag: tenant}, nil
+}
+
+//fillTenant 插入前填充租户列，已有值且不是当前租户时报错
+//跨租户写入时租户列必须已有值
+func fillTenant(c ctx2.BaseContext, list []Row) error {
+	tbl := list[0]
+	f, ok := findOpt(tbl, OptTenant)
+	if !ok {
+		return nil
+	}
+	cross := crossTenant(c)
+	tenant := TenantOf(c)
+	if !cross && tenant == "" {
+		return fmt.Errorf("%w: %s", ErrNoTenant, tbl.TableName())
+	}
+	for _, row := range list {
+		v := reflect.ValueOf(row)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			continue
+		}
+		fv := v.Elem().FieldByIndex(f.Index)
+		if cross {
+			if fv.IsZero() {
+				return fmt.Errorf("%s: tenant column %s is empty", tbl.TableName(), f.Tag)
+			}
+			continue
+		}
+		if fv.IsZero() {
+			if err := setTenant(fv, tenant); err != nil {
+				return fmt.Errorf("%s.%s: %w", tbl.TableName(), f.Tag, err)
+			}
+			continue
+		}
+		if fmt.Sprint(fv.Interface()) != tenant {
+			return fmt.Errorf("%s: row of tenant %v can not be written by tenant %s", tbl.TableName(), fv.Interface(), tenant)
+		}
+	}
+	return nil
+}
+
+//setTenant 按字段类型写入租户，支持字符串和整数
+func setTenant(v reflect.Value, tenant string) error {
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(tenant)
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		n, err := strconv.ParseInt(tenant, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		n, err := strconv.ParseUint(tenant, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported tenant type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package mysql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// TLSConf 自定义 TLS 证书，文件路径
+type TLSConf struct {
+	//CA 证书，为空时使用系统证书
+	CA string `json:"ca"`
+	//客户端证书和私钥，双向认证时配置
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+	//校验的服务端名称，默认为 host
+	ServerName         string `json:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+//tlsName DSN 中的 tls 参数，配置 tls_config 时为注册的名称
+func (v Conf) tlsName() string {
+	if v.TLSConfig != nil {
+		return strings.NewReplacer(":", "_", "/", "_").Replace(fmt.Sprintf("gin-utils-%s-%d-%s", v.Host, v.Port, v.DBName))
+	}
+	return v.TLS
+}
+
+//registerTLS 向驱动注册自定义 TLS 配置
+func (v Conf) registerTLS() error {
+	c := v.TLSConfig
+	if c == nil {
+		return nil
+	}
+	cfg := &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.InsecureSkipVerify}
+	if cfg.ServerName == "" {
+		cfg.ServerName = v.Host
+	}
+	if c.CA != "" {
+		pem, err := os.ReadFile(c.CA)
+		if err != nil {
+			return fmt.Errorf("mysql tls ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("mysql tls ca: no certificate found in %s", c.CA)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.Cert != "" || c.Key != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return fmt.Errorf("mysql tls cert: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return driver.RegisterTLSConfig(v.tlsName(), cfg)
+}
@@ -0,0 +1,145 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/582033/gin-utils/log"
+
+	sq "github.com/Masterminds/squirrel"
+	driver "github.com/go-sql-driver/mysql"
+)
+
+const (
+	//DeadlockErrNo 死锁
+	DeadlockErrNo = 1213
+	//LockWaitTimeoutErrNo 锁等待超时
+	LockWaitTimeoutErrNo = 1205
+)
+
+type txOptions struct {
+	opts       *sql.TxOptions
+	maxRetries int
+	backoff    time.Duration
+}
+
+// TxOption WithTx 的可选参数
+type TxOption func(o *txOptions)
+
+// WithTxOptions 设置隔离级别、只读等事务参数，嵌套调用时忽略
+func WithTxOptions(opts *sql.TxOptions) TxOption {
+	return func(o *txOptions) {
+		o.opts = opts
+	}
+}
+
+// WithRetry 遇到死锁(1213)、锁等待超时(1205)或乐观锁冲突时重试整个 fn，backoff 为首次重试的等待时间，之后指数增长
+// 只对最外层事务生效，fn 需要可重复执行
+func WithRetry(maxRetries int, backoff time.Duration) TxOption {
+	return func(o *txOptions) {
+		o.maxRetries = maxRetries
+		o.backoff = backoff
+	}
+}
+
+// IsRetryable 判断错误是否可以通过重试事务解决，包括乐观锁冲突 ErrStaleObject
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrStaleObject) {
+		return true
+	}
+	var e *driver.MySQLError
+	if errors.As(err, &e) {
+		return e.Number == DeadlockErrNo || e.Number == LockWaitTimeoutErrNo
+	}
+	return false
+}
+
+// WithTx 在事务中执行 fn，fn 返回 nil 时提交，返回错误或 panic 时回滚
+// runner 为 *Tx 时使用 SAVEPOINT 实现嵌套事务
+func WithTx(ctx context.Context, runner sq.BaseRunner, fn func(tx *Tx) error, opts ...TxOption) error {
+	switch r := runner.(type) {
+	case *DBConn:
+		return r.WithTx(ctx, fn, opts...)
+	case *Tx:
+		return r.WithTx(ctx, fn)
+	}
+	return fmt.Errorf("mysql: unsupported runner %T for WithTx", runner)
+}
+
+// WithTx 开启事务执行 fn，fn 返回 nil 时提交，返回错误或 panic 时回滚
+func (dbConn *DBConn) WithTx(ctx context.Context, fn func(tx *Tx) error, opts ...TxOption) error {
+	o := &txOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	for attempt := 0; ; attempt++ {
+		err := dbConn.runTx(ctx, o.opts, fn)
+		if err == nil || attempt >= o.maxRetries || !IsRetryable(err) {
+			return err
+		}
+		wait := o.backoff << uint(attempt)
+		if wait > 0 {
+			wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+		}
+		log.WithCtx(ctx).Warnf("mysql tx retry %d/%d after %s: %s", attempt+1, o.maxRetries, wait, err.Error())
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (dbConn *DBConn) runTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) (err error) {
+	tx, err := dbConn.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.WithCtx(ctx).Error("mysql tx rollback error ", rbErr)
+			}
+			panic(p)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.WithCtx(ctx).Error("mysql tx rollback error ", rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// WithTx 嵌套事务，使用 SAVEPOINT 实现，fn 失败时只回滚到保存点
+func (tx *Tx) WithTx(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	tx.depth++
+	name := fmt.Sprintf("sp_%d", tx.depth)
+	defer func() {
+		tx.depth--
+	}()
+	if _, err = tx.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			if _, rbErr := tx.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+				log.WithCtx(ctx).Error("mysql savepoint rollback error ", rbErr)
+			}
+			panic(p)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		if _, rbErr := tx.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			log.WithCtx(ctx).Error("mysql savepoint rollback error ", rbErr)
+		}
+		return err
+	}
+	_, err = tx.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
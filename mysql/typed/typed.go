@@ -0,0 +1,110 @@
+package typed
+
+import (
+	"database/sql"
+
+	"github.com/582033/gin-utils/ctx"
+	"github.com/582033/gin-utils/mysql"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// PT 约束 *T 实现 mysql.Table，调用时只需写出结构体类型 Select[Order](...)
+type PT[T any] interface {
+	*T
+	mysql.Table
+}
+
+// Select 查询多条记录，直接返回具体结构体切片
+func Select[T any, P PT[T]](ctx ctx.BaseContext, runner sq.BaseRunner, selectBuilder func(tblName string) sq.SelectBuilder) ([]T, error) {
+	var list []T
+	if err := mysql.SelectScan(ctx, runner, P(new(T)), selectBuilder, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// SelectOne 查询一条记录，没有数据时返回 sql.ErrNoRows
+func SelectOne[T any, P PT[T]](ctx ctx.BaseContext, runner sq.BaseRunner, selectBuilder func(tblName string) sq.SelectBuilder) (*T, error) {
+	list, err := Select[T, P](ctx, runner, selectBuilder)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &list[0], nil
+}
+
+// Insert 插入单条
+func Insert[T any, P PT[T]](ctx ctx.BaseContext, runner sq.BaseRunner, row P) (lastID int64, err error) {
+	return mysql.Insert(ctx, runner, row)
+}
+
+// BulkInsert 批量插入
+func BulkInsert[T any, P PT[T]](ctx ctx.BaseContext, runner sq.BaseRunner, list []P) (count int64, err error) {
+	rows := make([]mysql.Row, 0, len(list))
+	for _, row := range list {
+		rows = append(rows, row)
+	}
+	return mysql.BulkInsert(ctx, runner, rows...)
+}
+
+// BulkInsertWith 批量插入，可配置批量大小、事务和 INSERT IGNORE
+func BulkInsertWith[T any, P PT[T]](ctx ctx.BaseContext, runner sq.BaseRunner, list []P, opts ...mysql.BulkOption) (*mysql.BulkResult, error) {
+	rows := make([]mysql.Row, 0, len(list))
+	for _, row := range list {
+		rows = append(rows, row)
+	}
+	return mysql.BulkInsertWith(ctx, runner, rows, opts...)
+}
+
+// FindByPK 按主键查询一条记录，不存在时返回 sql.ErrNoRows
+func FindByPK[T any, P PT[T]](ctx ctx.BaseContext, runner sq.BaseRunner, ids ...interface{}) (*T, error) {
+	row, err := mysql.FindByPK(ctx, runner, P(new(T)), ids...)
+	if err != nil {
+		return nil, err
+	}
+	return (*T)(row.(P)), nil
+}
+
+// Paginate 分页查询，page 从 1 开始
+func Paginate[T any, P PT[T]](ctx ctx.BaseContext, runner sq.BaseRunner, selectBuilder func(tblName string) sq.SelectBuilder, page, size uint64) (*mysql.Page[T], error) {
+	res, err := mysql.Paginate(ctx, runner, P(new(T)), selectBuilder, page, size)
+	if err != nil {
+		return nil, err
+	}
+	return &mysql.Page[T]{Items: toSlice[T, P](res.Items), Total: res.Total, Page: res.Page, Size: res.Size}, nil
+}
+
+// PaginateCursor 游标(keyset)分页，cursor 为上一页返回的 Next，首页传空
+func PaginateCursor[T any, P PT[T]](ctx ctx.BaseContext, runner sq.BaseRunner, selectBuilder func(tblName string) sq.SelectBuilder, cursor string, size uint64, keys ...mysql.SortKey) (*mysql.CursorPage[T], error) {
+	res, err := mysql.PaginateCursor(ctx, runner, P(new(T)), selectBuilder, cursor, size, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return &mysql.CursorPage[T]{Items: toSlice[T, P](res.Items), Next: res.Next, HasMore: res.HasMore}, nil
+}
+
+// Each 逐行查询并回调，fn 返回错误时停止
+func Each[T any, P PT[T]](ctx ctx.BaseContext, runner sq.BaseRunner, selectBuilder func(tblName string) sq.SelectBuilder, fn func(row *T) error) error {
+	return mysql.Each(ctx, runner, P(new(T)), selectBuilder, func(row mysql.Row) error {
+		return fn((*T)(row.(P)))
+	})
+}
+
+// EachBatch 逐行查询，每 size 行回调一次，最后一批可能不足 size
+func EachBatch[T any, P PT[T]](ctx ctx.BaseContext, runner sq.BaseRunner, selectBuilder func(tblName string) sq.SelectBuilder, size int, fn func(list []T) error) error {
+	return mysql.EachBatch(ctx, runner, P(new(T)), selectBuilder, size, func(rows []mysql.Row) error {
+		return fn(toSlice[T, P](rows))
+	})
+}
+
+// toSlice mysql.Select 返回的记录均为 *T
+func toSlice[T any, P PT[T]](rows []mysql.Row) []T {
+	list := make([]T, 0, len(rows))
+	for _, row := range rows {
+		list = append(list, *(*T)(row.(P)))
+	}
+	return list
+}
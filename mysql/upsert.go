@@ -0,0 +1,167 @@
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/582033/gin-utils/ctx"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// UpsertResult 写入结果
+// MySQL 对 ON DUPLICATE KEY UPDATE 新插入的行计 1，更新的行计 2，值未变化的行计 0
+// 批量时无法精确区分，按最少更新行数推算 Inserted/Updated/Unchanged
+// PostgreSQL、SQLite 只统计 Affected
+type UpsertResult struct {
+	Affected  int64
+	Inserted  int64
+	Updated   int64
+	Unchanged int64
+	LastID    int64
+}
+
+type upsertOptions struct {
+	update   []string
+	exclude  []string
+	conflict []string
+}
+
+// UpsertOption Upsert 的可选参数
+type UpsertOption func(o *upsertOptions)
+
+// UpdateColumns 冲突时只更新指定的列
+func UpdateColumns(columns ...string) UpsertOption {
+	return func(o *upsertOptions) {
+		o.update = append(o.update, columns...)
+	}
+}
+
+// ExcludeColumns 冲突时不更新的列，如唯一键、created_at，未指定 UpdateColumns 时生效
+// 主键、自增列和 created 列始终不更新
+func ExcludeColumns(columns ...string) UpsertOption {
+	return func(o *upsertOptions) {
+		o.exclude = append(o.exclude, columns...)
+	}
+}
+
+// ConflictColumns PostgreSQL、SQLite 判断冲突的唯一键列，默认为主键，MySQL 忽略
+func ConflictColumns(columns ...string) UpsertOption {
+	return func(o *upsertOptions) {
+		o.conflict = append(o.conflict, columns...)
+	}
+}
+
+// Upsert 写入单条，唯一键冲突时更新，默认更新除主键和 ExcludeColumns 外的所有列
+// 租户表冲突的行属于其他租户时不更新，该行计入 Unchanged
+func Upsert(ctx ctx.BaseContext, runner sq.BaseRunner, row Row, opts ...UpsertOption) (*UpsertResult, error) {
+	return BulkUpsert(ctx, runner, []Row{row}, opts...)
+}
+
+// BulkUpsert 批量写入，唯一键冲突时更新，每批 100 条
+func BulkUpsert(ctx ctx.BaseContext, runner sq.BaseRunner, list []Row, opts ...UpsertOption) (*UpsertResult, error) {
+	result := &UpsertResult{}
+	if len(list) == 0 {
+		return result, nil
+	}
+	//冲突的行可能来自任意唯一键，无法取得更新前的行
+	if audited(list[0]) {
+		return result, fmt.Errorf("%s is audited, upsert is not supported", list[0].TableName())
+	}
+	o := &upsertOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	per := 100
+	for begin := 0; begin < len(list); begin += per {
+		end := begin + per
+		if end > len(list) {
+			end = len(list)
+		}
+		r, err := upsertMany(ctx, runner, list[begin:end], o)
+		if err != nil {
+			return result, err
+		}
+		result.Affected += r.Affected
+		result.Inserted += r.Inserted
+		result.Updated += r.Updated
+		result.Unchanged += r.Unchanged
+		result.LastID = r.LastID
+	}
+	return result, nil
+}
+
+func upsertMany(ctx ctx.BaseContext, runner sq.BaseRunner, list []Row, o *upsertOptions) (*UpsertResult, error) {
+	if err := fillTenant(ctx, list); err != nil {
+		return nil, err
+	}
+	defer invalidate(runner, list[0])
+	touchCreated(list)
+	b, err := insertBuilder(list, false)
+	if err != nil {
+		return nil, err
+	}
+	columns := upsertColumns(list[0], o)
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns to update on duplicate key")
+	}
+	d := dialectOf(runner)
+	conflict := o.conflict
+	if len(conflict) == 0 && d.Name() != DialectMySQL {
+		pks, err := pkFields(list[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range pks {
+			conflict = append(conflict, f.Tag)
+		}
+	}
+	//冲突的行属于其他租户时不更新
+	f, _, scoped, err := tenantScope(ctx, list[0])
+	if err != nil {
+		return nil, err
+	}
+	var guard string
+	if scoped {
+		guard = f.Tag
+	}
+	b = b.Suffix(d.Upsert(columns, conflict, guard))
+
+	res, err := b.RunWith(runner).ExecContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &UpsertResult{}
+	result.Affected, _ = res.RowsAffected()
+	if d.Name() != DialectMySQL {
+		//ON CONFLICT 插入和更新都计 1，无法区分
+		return result, nil
+	}
+	result.LastID, _ = res.LastInsertId()
+
+	n := int64(len(list))
+	if result.Affected > n {
+		result.Updated = result.Affected - n
+	}
+	result.Inserted = result.Affected - 2*result.Updated
+	result.Unchanged = n - result.Inserted - result.Updated
+	return result, nil
+}
+
+// upsertColumns 冲突时需要更新的列
+func upsertColumns(row Row, o *upsertOptions) []string {
+	if len(o.update) > 0 {
+		return o.update
+	}
+	exclude := make(map[string]bool, len(o.exclude))
+	for _, c := range o.exclude {
+		exclude[c] = true
+	}
+	fields := sortedField(row)
+	columns := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if !exclude[f.Tag] && !f.Has(OptPK) && !f.Has(OptAuto) && !f.Has(OptCreated) && !f.Has(OptTenant) {
+			columns = append(columns, f.Tag)
+		}
+	}
+	return columns
+}
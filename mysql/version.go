@@ -0,0 +1,30 @@
+package mysql
+
+import (
+	"errors"
+	"reflect"
+)
+
+// OptVersion 乐观锁版本列，整数类型，如 orm:"version,version"
+const OptVersion = "version"
+
+// ErrStaleObject 按版本号更新时记录已被修改或删除
+var ErrStaleObject = errors.New("mysql: stale object")
+
+//versionValue 版本号字段的值
+func versionValue(v reflect.Value) int64 {
+	if v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64 {
+		return int64(v.Uint())
+	}
+	return v.Int()
+}
+
+//setInt 写入整数字段，用于回写版本号和自增 ID
+func setInt(v reflect.Value, n int64) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(n))
+	}
+}
@@ -0,0 +1,555 @@
+package redis
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Fake 内存版 redis，实现了 RESP 协议中常用的命令，用于单元测试
+type Fake struct {
+	listener net.Listener
+	mu       sync.Mutex
+	dbs      map[int]map[string]*fakeItem
+	offset   time.Duration
+	scripts  map[string]FakeScript
+	bodies   map[string]string
+	conns    map[*fakeConn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// FakeScript EVAL 脚本的 Go 实现
+// call 在同一把锁内执行 redis 命令，回复值类型与 redigo 读取到的一致
+type FakeScript func(call func(args ...interface{}) (interface{}, error), keys, argv []string) (interface{}, error)
+
+// fakeStatus 状态回复 +OK
+type fakeStatus string
+
+// fakeError 错误回复，内容原样输出
+type fakeError string
+
+func (e fakeError) Error() string {
+	return string(e)
+}
+
+type fakeItem struct {
+	kind     string
+	str      string
+	hash     map[string]string
+	list     []string
+	set      map[string]struct{}
+	zset     map[string]float64
+	expireAt time.Time
+}
+
+type fakeConn struct {
+	fake     *Fake
+	conn     net.Conn
+	reader   *bufio.Reader
+	writer   *bufio.Writer
+	writeMu  sync.Mutex
+	db       int
+	multi    [][]string
+	inMulti  bool
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+// NewFake 启动一个监听本地随机端口的内存版 redis
+func NewFake() (*Fake, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	f := &Fake{
+		listener: l,
+		dbs:      make(map[int]map[string]*fakeItem),
+		scripts:  make(map[string]FakeScript),
+		bodies:   make(map[string]string),
+		conns:    make(map[*fakeConn]struct{}),
+	}
+	f.wg.Add(1)
+	go f.serve()
+	return f, nil
+}
+
+// RegisterFake 启动内存版 redis 并注册到 key 下，之后 Conn(key)/Default() 都会连到它
+func RegisterFake(key string) (*Fake, error) {
+	f, err := NewFake()
+	if err != nil {
+		return nil, err
+	}
+	Register(key, f.Pool())
+	return f, nil
+}
+
+// Addr 监听地址
+func (f *Fake) Addr() string {
+	return f.listener.Addr().String()
+}
+
+// Pool 返回连接到该实例的连接池
+func (f *Fake) Pool() *redis.Pool {
+	addr := f.Addr()
+	return &redis.Pool{
+		MaxIdle:     10,
+		IdleTimeout: time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr)
+		},
+		TestOnBorrow: func(c redis.Conn, _ time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+}
+
+// Close 关闭监听和所有客户端连接
+func (f *Fake) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	err := f.listener.Close()
+	for c := range f.conns {
+		_ = c.conn.Close()
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return err
+}
+
+// FlushAll 清空所有数据
+func (f *Fake) FlushAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dbs = make(map[int]map[string]*fakeItem)
+}
+
+// FastForward 时间快进，用于测试过期逻辑
+func (f *Fake) FastForward(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.offset += d
+}
+
+// RegisterScript 注册 EVAL 脚本的实现，脚本按内容的 sha1 匹配
+func (f *Fake) RegisterScript(script string, fn FakeScript) string {
+	sha := scriptSHA(script)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts[sha] = fn
+	f.bodies[sha] = script
+	return sha
+}
+
+func scriptSHA(script string) string {
+	h := sha1.Sum([]byte(script))
+	return hex.EncodeToString(h[:])
+}
+
+func (f *Fake) now() time.Time {
+	return time.Now().Add(f.offset)
+}
+
+func (f *Fake) serve() {
+	defer f.wg.Done()
+	for {
+		c, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		fc := &fakeConn{
+			fake:     f,
+			conn:     c,
+			reader:   bufio.NewReader(c),
+			writer:   bufio.NewWriter(c),
+			channels: make(map[string]struct{}),
+			patterns: make(map[string]struct{}),
+		}
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			_ = c.Close()
+			return
+		}
+		f.conns[fc] = struct{}{}
+		f.mu.Unlock()
+		f.wg.Add(1)
+		go fc.serve()
+	}
+}
+
+func (c *fakeConn) serve() {
+	defer c.fake.wg.Done()
+	defer func() {
+		c.fake.mu.Lock()
+		delete(c.fake.conns, c)
+		c.fake.mu.Unlock()
+		_ = c.conn.Close()
+	}()
+	for {
+		args, err := readCommand(c.reader)
+		if err != nil {
+			if err != io.EOF {
+				c.write(fakeError("ERR Protocol error: " + err.Error()))
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if !c.handle(args) {
+			return
+		}
+	}
+}
+
+// handle 处理一条命令，返回 false 时关闭连接
+func (c *fakeConn) handle(args []string) bool {
+	name := strings.ToUpper(args[0])
+	subscribed := len(c.channels)+len(c.patterns) > 0
+	if subscribed {
+		switch name {
+		case "SUBSCRIBE", "UNSUBSCRIBE", "PSUBSCRIBE", "PUNSUBSCRIBE", "PING", "QUIT":
+		default:
+			c.write(fakeError("ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT allowed in this context"))
+			return true
+		}
+	}
+	switch name {
+	case "QUIT":
+		c.write(fakeStatus("OK"))
+		return false
+	case "AUTH":
+		c.write(fakeStatus("OK"))
+	case "SELECT":
+		if len(args) != 2 {
+			c.write(errArgs(name))
+			return true
+		}
+		db, err := strconv.Atoi(args[1])
+		if err != nil || db < 0 {
+			c.write(fakeError("ERR DB index is out of range"))
+			return true
+		}
+		c.db = db
+		c.write(fakeStatus("OK"))
+	case "MULTI":
+		if c.inMulti {
+			c.write(fakeError("ERR MULTI calls can not be nested"))
+			return true
+		}
+		c.inMulti = true
+		c.multi = nil
+		c.write(fakeStatus("OK"))
+	case "DISCARD":
+		if !c.inMulti {
+			c.write(fakeError("ERR DISCARD without MULTI"))
+			return true
+		}
+		c.inMulti = false
+		c.multi = nil
+		c.write(fakeStatus("OK"))
+	case "EXEC":
+		if !c.inMulti {
+			c.write(fakeError("ERR EXEC without MULTI"))
+			return true
+		}
+		queued := c.multi
+		c.inMulti = false
+		c.multi = nil
+		c.fake.mu.Lock()
+		replies := make([]interface{}, 0, len(queued))
+		for _, cmd := range queued {
+			replies = append(replies, c.fake.exec(c.db, cmd))
+		}
+		c.fake.mu.Unlock()
+		c.write(replies)
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		if len(args) < 2 {
+			c.write(errArgs(name))
+			return true
+		}
+		//持有锁时只记录回复，释放后再写，避免阻塞的客户端拖住其他连接
+		c.fake.mu.Lock()
+		replies := make([]interface{}, 0, len(args)-1)
+		for _, ch := range args[1:] {
+			if name == "SUBSCRIBE" {
+				c.channels[ch] = struct{}{}
+			} else {
+				c.patterns[ch] = struct{}{}
+			}
+			replies = append(replies, []interface{}{strings.ToLower(name), ch, int64(len(c.channels) + len(c.patterns))})
+		}
+		c.fake.mu.Unlock()
+		c.writeAll(replies)
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		c.fake.mu.Lock()
+		set := c.channels
+		if name == "PUNSUBSCRIBE" {
+			set = c.patterns
+		}
+		targets := args[1:]
+		if len(targets) == 0 {
+			for ch := range set {
+				targets = append(targets, ch)
+			}
+		}
+		var replies []interface{}
+		if len(targets) == 0 {
+			replies = append(replies, []interface{}{strings.ToLower(name), nil, int64(len(c.channels) + len(c.patterns))})
+		}
+		for _, ch := range targets {
+			delete(set, ch)
+			replies = append(replies, []interface{}{strings.ToLower(name), ch, int64(len(c.channels) + len(c.patterns))})
+		}
+		c.fake.mu.Unlock()
+		c.writeAll(replies)
+	case "PING":
+		if subscribed {
+			msg := ""
+			if len(args) > 1 {
+				msg = args[1]
+			}
+			c.write([]interface{}{"pong", msg})
+			return true
+		}
+		if len(args) > 1 {
+			c.write(args[1])
+			return true
+		}
+		c.write(fakeStatus("PONG"))
+	case "PUBLISH":
+		if len(args) != 3 {
+			c.write(errArgs(name))
+			return true
+		}
+		c.write(int64(c.fake.publish(args[1], args[2])))
+	default:
+		if c.inMulti {
+			if _, ok := fakeCommands[name]; !ok && !isServerCommand(name) {
+				c.write(fakeError(fmt.Sprintf("ERR unknown command '%s'", args[0])))
+				return true
+			}
+			c.multi = append(c.multi, args)
+			c.write(fakeStatus("QUEUED"))
+			return true
+		}
+		c.fake.mu.Lock()
+		reply := c.fake.exec(c.db, args)
+		c.fake.mu.Unlock()
+		c.write(reply)
+	}
+	return true
+}
+
+// publish 向订阅者推送消息，返回接收者数量
+func (f *Fake) publish(channel, message string) int {
+	type target struct {
+		conn    *fakeConn
+		pattern string
+	}
+	var targets []target
+	f.mu.Lock()
+	for c := range f.conns {
+		if _, ok := c.channels[channel]; ok {
+			targets = append(targets, target{conn: c})
+		}
+		for p := range c.patterns {
+			if globMatch(p, channel) {
+				targets = append(targets, target{conn: c, pattern: p})
+			}
+		}
+	}
+	f.mu.Unlock()
+	for _, t := range targets {
+		if t.pattern == "" {
+			t.conn.write([]interface{}{"message", channel, message})
+		} else {
+			t.conn.write([]interface{}{"pmessage", t.pattern, channel, message})
+		}
+	}
+	return len(targets)
+}
+
+func (c *fakeConn) write(reply interface{}) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	writeReply(c.writer, reply)
+	_ = c.writer.Flush()
+}
+
+// writeAll 依次写入多条回复，如订阅命令每个频道一条
+func (c *fakeConn) writeAll(replies []interface{}) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	for _, reply := range replies {
+		writeReply(c.writer, reply)
+	}
+	_ = c.writer.Flush()
+}
+
+// readCommand 读取一条命令，支持 RESP 数组和 inline 两种格式
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid multibulk length")
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("expected '$', got '%s'", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid bulk length")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case fakeStatus:
+		_, _ = w.WriteString("+" + string(v) + "\r\n")
+	case fakeError:
+		_, _ = w.WriteString("-" + string(v) + "\r\n")
+	case error:
+		_, _ = w.WriteString("-ERR " + v.Error() + "\r\n")
+	case int64:
+		_, _ = w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case int:
+		_, _ = w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case bool:
+		if v {
+			_, _ = w.WriteString(":1\r\n")
+		} else {
+			_, _ = w.WriteString("$-1\r\n")
+		}
+	case string:
+		_, _ = w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case []byte:
+		_, _ = w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n")
+		_, _ = w.Write(v)
+		_, _ = w.WriteString("\r\n")
+	case []string:
+		_, _ = w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	case []interface{}:
+		_, _ = w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		writeReply(w, fmt.Sprint(v))
+	}
+}
+
+// globMatch redis 风格的通配符匹配，支持 * ? [...] 和 \ 转义
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				return pattern == s
+			}
+			class := pattern[1 : end+1]
+			negate := len(class) > 0 && class[0] == '^'
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if s[0] >= class[i] && s[0] <= class[i+2] {
+						matched = true
+					}
+					i += 2
+				} else if class[i] == s[0] {
+					matched = true
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
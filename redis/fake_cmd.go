@@ -0,0 +1,1463 @@
+package redis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const wrongType = fakeError("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+type fakeCommand func(f *Fake, db map[string]*fakeItem, args []string) interface{}
+
+// fakeCommands 支持的数据命令，调用时已持有 Fake.mu
+var fakeCommands map[string]fakeCommand
+
+func init() {
+	fakeCommands = map[string]fakeCommand{
+		"ECHO":             cmdEcho,
+		"DBSIZE":           cmdDBSize,
+		"FLUSHDB":          cmdFlushDB,
+		"KEYS":             cmdKeys,
+		"TYPE":             cmdType,
+		"EXISTS":           cmdExists,
+		"DEL":              cmdDel,
+		"UNLINK":           cmdDel,
+		"EXPIRE":           cmdExpire,
+		"PEXPIRE":          cmdExpire,
+		"PERSIST":          cmdPersist,
+		"TTL":              cmdTTL,
+		"PTTL":             cmdTTL,
+		"GET":              cmdGet,
+		"SET":              cmdSet,
+		"SETEX":            cmdSetEx,
+		"SETNX":            cmdSetNX,
+		"GETSET":           cmdGetSet,
+		"MGET":             cmdMGet,
+		"MSET":             cmdMSet,
+		"INCR":             cmdIncr,
+		"DECR":             cmdIncr,
+		"INCRBY":           cmdIncr,
+		"DECRBY":           cmdIncr,
+		"HSET":             cmdHSet,
+		"HMSET":            cmdHSet,
+		"HSETNX":           cmdHSetNX,
+		"HGET":             cmdHGet,
+		"HMGET":            cmdHMGet,
+		"HGETALL":          cmdHGetAll,
+		"HKEYS":            cmdHGetAll,
+		"HVALS":            cmdHGetAll,
+		"HDEL":             cmdHDel,
+		"HEXISTS":          cmdHExists,
+		"HLEN":             cmdHLen,
+		"HINCRBY":          cmdHIncrBy,
+		"LPUSH":            cmdPush,
+		"RPUSH":            cmdPush,
+		"LPOP":             cmdPop,
+		"RPOP":             cmdPop,
+		"LLEN":             cmdLLen,
+		"LRANGE":           cmdLRange,
+		"LTRIM":            cmdLTrim,
+		"LREM":             cmdLRem,
+		"LINDEX":           cmdLIndex,
+		"SADD":             cmdSAdd,
+		"SREM":             cmdSRem,
+		"SISMEMBER":        cmdSIsMember,
+		"SMEMBERS":         cmdSMembers,
+		"SCARD":            cmdSCard,
+		"ZADD":             cmdZAdd,
+		"ZINCRBY":          cmdZIncrBy,
+		"ZCARD":            cmdZCard,
+		"ZCOUNT":           cmdZCount,
+		"ZSCORE":           cmdZScore,
+		"ZRANK":            cmdZRank,
+		"ZREVRANK":         cmdZRank,
+		"ZRANGE":           cmdZRange,
+		"ZREVRANGE":        cmdZRange,
+		"ZRANGEBYSCORE":    cmdZRangeByScore,
+		"ZREVRANGEBYSCORE": cmdZRangeByScore,
+		"ZREM":             cmdZRem,
+		"ZREMRANGEBYRANK":  cmdZRemRangeByRank,
+		"ZREMRANGEBYSCORE": cmdZRemRangeByScore,
+	}
+}
+
+func isServerCommand(name string) bool {
+	return name == "EVAL" || name == "EVALSHA" || name == "SCRIPT" || name == "FLUSHALL"
+}
+
+// exec 执行一条数据命令，调用方需持有 f.mu
+func (f *Fake) exec(dbIndex int, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	switch name {
+	case "FLUSHALL":
+		f.dbs = make(map[int]map[string]*fakeItem)
+		return fakeStatus("OK")
+	case "EVAL", "EVALSHA":
+		return f.eval(dbIndex, name, args)
+	case "SCRIPT":
+		return f.script(args)
+	}
+	cmd, ok := fakeCommands[name]
+	if !ok {
+		return fakeError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+	db, ok := f.dbs[dbIndex]
+	if !ok {
+		db = make(map[string]*fakeItem)
+		f.dbs[dbIndex] = db
+	}
+	return cmd(f, db, args)
+}
+
+func (f *Fake) eval(dbIndex int, name string, args []string) interface{} {
+	if len(args) < 3 {
+		return errArgs(name)
+	}
+	sha := args[1]
+	if name == "EVAL" {
+		sha = scriptSHA(args[1])
+	}
+	fn, ok := f.scripts[sha]
+	if !ok {
+		if name == "EVAL" {
+			return fakeError("ERR fake redis: script is not registered, use Fake.RegisterScript")
+		}
+		return fakeError("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	numKeys, err := strconv.Atoi(args[2])
+	if err != nil || numKeys < 0 || numKeys > len(args)-3 {
+		return fakeError("ERR Number of keys can't be greater than number of args")
+	}
+	keys := args[3 : 3+numKeys]
+	argv := args[3+numKeys:]
+	call := func(cmdArgs ...interface{}) (interface{}, error) {
+		list := make([]string, 0, len(cmdArgs))
+		for _, a := range cmdArgs {
+			list = append(list, fmt.Sprint(a))
+		}
+		if len(list) == 0 {
+			return nil, fakeError("ERR Please specify at least one argument for redis.call()")
+		}
+		return toClientReply(f.exec(dbIndex, list))
+	}
+	res, err := fn(call, keys, argv)
+	if err != nil {
+		if fe, ok := err.(fakeError); ok {
+			return fe
+		}
+		return fakeError("ERR " + err.Error())
+	}
+	return res
+}
+
+func (f *Fake) script(args []string) interface{} {
+	if len(args) < 2 {
+		return errArgs("SCRIPT")
+	}
+	switch strings.ToUpper(args[1]) {
+	case "LOAD":
+		if len(args) != 3 {
+			return errArgs("SCRIPT")
+		}
+		sha := scriptSHA(args[2])
+		f.bodies[sha] = args[2]
+		return sha
+	case "EXISTS":
+		res := make([]interface{}, 0, len(args)-2)
+		for _, sha := range args[2:] {
+			_, ok := f.bodies[sha]
+			res = append(res, boolInt(ok))
+		}
+		return res
+	case "FLUSH":
+		f.bodies = make(map[string]string)
+		return fakeStatus("OK")
+	}
+	return fakeError("ERR Unknown SCRIPT subcommand '" + args[1] + "'")
+}
+
+// toClientReply 将内部回复转换为 redigo 读取到的类型
+func toClientReply(reply interface{}) (interface{}, error) {
+	switch v := reply.(type) {
+	case fakeError:
+		return nil, v
+	case fakeStatus:
+		return string(v), nil
+	case string:
+		return []byte(v), nil
+	case int:
+		return int64(v), nil
+	case []interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			r, _ := toClientReply(item)
+			list = append(list, r)
+		}
+		return list, nil
+	}
+	return reply, nil
+}
+
+func errArgs(name string) fakeError {
+	return fakeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// lookup 获取未过期的 key
+func (f *Fake) lookup(db map[string]*fakeItem, key string) *fakeItem {
+	item, ok := db[key]
+	if !ok {
+		return nil
+	}
+	if !item.expireAt.IsZero() && !f.now().Before(item.expireAt) {
+		delete(db, key)
+		return nil
+	}
+	return item
+}
+
+// lookupKind 获取指定类型的 key，不存在时按需创建
+func (f *Fake) lookupKind(db map[string]*fakeItem, key, kind string, create bool) (*fakeItem, fakeError) {
+	item := f.lookup(db, key)
+	if item == nil {
+		if !create {
+			return nil, ""
+		}
+		item = &fakeItem{kind: kind}
+		switch kind {
+		case "hash":
+			item.hash = make(map[string]string)
+		case "set":
+			item.set = make(map[string]struct{})
+		case "zset":
+			item.zset = make(map[string]float64)
+		}
+		db[key] = item
+		return item, ""
+	}
+	if item.kind != kind {
+		return nil, wrongType
+	}
+	return item, ""
+}
+
+// cleanup 集合类 key 为空时删除
+func cleanup(db map[string]*fakeItem, key string, item *fakeItem) {
+	switch item.kind {
+	case "hash":
+		if len(item.hash) == 0 {
+			delete(db, key)
+		}
+	case "list":
+		if len(item.list) == 0 {
+			delete(db, key)
+		}
+	case "set":
+		if len(item.set) == 0 {
+			delete(db, key)
+		}
+	case "zset":
+		if len(item.zset) == 0 {
+			delete(db, key)
+		}
+	}
+}
+
+// normalizeRange 将 redis 的 start/stop（支持负数）转换为切片下标，返回 ok=false 表示空区间
+func normalizeRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start = n + start
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return start, stop + 1, true
+}
+
+func parseInts(args ...string) ([]int, fakeError) {
+	res := make([]int, 0, len(args))
+	for _, a := range args {
+		n, err := strconv.Atoi(a)
+		if err != nil {
+			return nil, fakeError("ERR value is not an integer or out of range")
+		}
+		res = append(res, n)
+	}
+	return res, ""
+}
+
+func formatScore(score float64) string {
+	if math.IsInf(score, 1) {
+		return "inf"
+	}
+	if math.IsInf(score, -1) {
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+//************* KEY ****************/
+
+func cmdEcho(_ *Fake, _ map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	return args[1]
+}
+
+func cmdDBSize(f *Fake, db map[string]*fakeItem, _ []string) interface{} {
+	var n int64
+	for k := range db {
+		if f.lookup(db, k) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdFlushDB(_ *Fake, db map[string]*fakeItem, _ []string) interface{} {
+	for k := range db {
+		delete(db, k)
+	}
+	return fakeStatus("OK")
+}
+
+func cmdKeys(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	keys := make([]string, 0)
+	for k := range db {
+		if f.lookup(db, k) != nil && globMatch(args[1], k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func cmdType(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	item := f.lookup(db, args[1])
+	if item == nil {
+		return fakeStatus("none")
+	}
+	return fakeStatus(item.kind)
+}
+
+func cmdExists(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 2 {
+		return errArgs(args[0])
+	}
+	var n int64
+	for _, k := range args[1:] {
+		if f.lookup(db, k) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdDel(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 2 {
+		return errArgs(args[0])
+	}
+	var n int64
+	for _, k := range args[1:] {
+		if f.lookup(db, k) != nil {
+			delete(db, k)
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExpire(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs(args[0])
+	}
+	n, err := parseInts(args[2])
+	if err != "" {
+		return err
+	}
+	item := f.lookup(db, args[1])
+	if item == nil {
+		return int64(0)
+	}
+	unit := time.Second
+	if strings.ToUpper(args[0]) == "PEXPIRE" {
+		unit = time.Millisecond
+	}
+	item.expireAt = f.now().Add(time.Duration(n[0]) * unit)
+	return int64(1)
+}
+
+func cmdPersist(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	item := f.lookup(db, args[1])
+	if item == nil || item.expireAt.IsZero() {
+		return int64(0)
+	}
+	item.expireAt = time.Time{}
+	return int64(1)
+}
+
+func cmdTTL(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	item := f.lookup(db, args[1])
+	if item == nil {
+		return int64(-2)
+	}
+	if item.expireAt.IsZero() {
+		return int64(-1)
+	}
+	left := item.expireAt.Sub(f.now())
+	if strings.ToUpper(args[0]) == "PTTL" {
+		return int64(left / time.Millisecond)
+	}
+	return int64((left + time.Second - 1) / time.Second)
+}
+
+//************* STRING ****************/
+
+func cmdGet(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "string", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return nil
+	}
+	return item.str
+}
+
+func cmdSet(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 3 {
+		return errArgs(args[0])
+	}
+	var nx, xx, keepTTL bool
+	var expireAt time.Time
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return fakeError("ERR syntax error")
+			}
+			n, err := parseInts(args[i+1])
+			if err != "" {
+				return err
+			}
+			if n[0] <= 0 {
+				return fakeError("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			expireAt = f.now().Add(time.Duration(n[0]) * unit)
+			i++
+		default:
+			return fakeError("ERR syntax error")
+		}
+	}
+	old := f.lookup(db, args[1])
+	if (nx && old != nil) || (xx && old == nil) {
+		return nil
+	}
+	if keepTTL && old != nil && expireAt.IsZero() {
+		expireAt = old.expireAt
+	}
+	db[args[1]] = &fakeItem{kind: "string", str: args[2], expireAt: expireAt}
+	return fakeStatus("OK")
+}
+
+func cmdSetEx(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 4 {
+		return errArgs(args[0])
+	}
+	return cmdSet(f, db, []string{"SET", args[1], args[3], "EX", args[2]})
+}
+
+func cmdSetNX(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs(args[0])
+	}
+	if cmdSet(f, db, []string{"SET", args[1], args[2], "NX"}) == nil {
+		return int64(0)
+	}
+	return int64(1)
+}
+
+func cmdGetSet(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs(args[0])
+	}
+	old := cmdGet(f, db, args[:2])
+	if _, ok := old.(fakeError); ok {
+		return old
+	}
+	db[args[1]] = &fakeItem{kind: "string", str: args[2]}
+	return old
+}
+
+func cmdMGet(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 2 {
+		return errArgs(args[0])
+	}
+	res := make([]interface{}, 0, len(args)-1)
+	for _, k := range args[1:] {
+		item := f.lookup(db, k)
+		if item == nil || item.kind != "string" {
+			res = append(res, nil)
+			continue
+		}
+		res = append(res, item.str)
+	}
+	return res
+}
+
+func cmdMSet(_ *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return errArgs(args[0])
+	}
+	for i := 1; i < len(args); i += 2 {
+		db[args[i]] = &fakeItem{kind: "string", str: args[i+1]}
+	}
+	return fakeStatus("OK")
+}
+
+func cmdIncr(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	delta := int64(1)
+	switch name {
+	case "INCR", "DECR":
+		if len(args) != 2 {
+			return errArgs(name)
+		}
+	default:
+		if len(args) != 3 {
+			return errArgs(name)
+		}
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return fakeError("ERR value is not an integer or out of range")
+		}
+		delta = n
+	}
+	if name == "DECR" || name == "DECRBY" {
+		delta = -delta
+	}
+	item, ferr := f.lookupKind(db, args[1], "string", false)
+	if ferr != "" {
+		return ferr
+	}
+	var cur int64
+	var expireAt time.Time
+	if item != nil {
+		n, err := strconv.ParseInt(item.str, 10, 64)
+		if err != nil {
+			return fakeError("ERR value is not an integer or out of range")
+		}
+		cur = n
+		expireAt = item.expireAt
+	}
+	cur += delta
+	db[args[1]] = &fakeItem{kind: "string", str: strconv.FormatInt(cur, 10), expireAt: expireAt}
+	return cur
+}
+
+//************* HASH ****************/
+
+func cmdHSet(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 4 || len(args)%2 != 0 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "hash", true)
+	if err != "" {
+		return err
+	}
+	var n int64
+	for i := 2; i < len(args); i += 2 {
+		if _, ok := item.hash[args[i]]; !ok {
+			n++
+		}
+		item.hash[args[i]] = args[i+1]
+	}
+	if strings.ToUpper(args[0]) == "HMSET" {
+		return fakeStatus("OK")
+	}
+	return n
+}
+
+func cmdHSetNX(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 4 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "hash", true)
+	if err != "" {
+		return err
+	}
+	if _, ok := item.hash[args[2]]; ok {
+		return int64(0)
+	}
+	item.hash[args[2]] = args[3]
+	return int64(1)
+}
+
+func cmdHGet(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "hash", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return nil
+	}
+	if v, ok := item.hash[args[2]]; ok {
+		return v
+	}
+	return nil
+}
+
+func cmdHMGet(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 3 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "hash", false)
+	if err != "" {
+		return err
+	}
+	res := make([]interface{}, 0, len(args)-2)
+	for _, field := range args[2:] {
+		if item == nil {
+			res = append(res, nil)
+			continue
+		}
+		if v, ok := item.hash[field]; ok {
+			res = append(res, v)
+		} else {
+			res = append(res, nil)
+		}
+	}
+	return res
+}
+
+func cmdHGetAll(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "hash", false)
+	if err != "" {
+		return err
+	}
+	res := make([]string, 0)
+	if item == nil {
+		return res
+	}
+	fields := make([]string, 0, len(item.hash))
+	for k := range item.hash {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	name := strings.ToUpper(args[0])
+	for _, k := range fields {
+		switch name {
+		case "HKEYS":
+			res = append(res, k)
+		case "HVALS":
+			res = append(res, item.hash[k])
+		default:
+			res = append(res, k, item.hash[k])
+		}
+	}
+	return res
+}
+
+func cmdHDel(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 3 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "hash", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	var n int64
+	for _, field := range args[2:] {
+		if _, ok := item.hash[field]; ok {
+			delete(item.hash, field)
+			n++
+		}
+	}
+	cleanup(db, args[1], item)
+	return n
+}
+
+func cmdHExists(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "hash", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	_, ok := item.hash[args[2]]
+	return boolInt(ok)
+}
+
+func cmdHLen(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "hash", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	return int64(len(item.hash))
+}
+
+func cmdHIncrBy(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 4 {
+		return errArgs(args[0])
+	}
+	delta, perr := strconv.ParseInt(args[3], 10, 64)
+	if perr != nil {
+		return fakeError("ERR value is not an integer or out of range")
+	}
+	item, err := f.lookupKind(db, args[1], "hash", true)
+	if err != "" {
+		return err
+	}
+	var cur int64
+	if v, ok := item.hash[args[2]]; ok {
+		n, perr := strconv.ParseInt(v, 10, 64)
+		if perr != nil {
+			return fakeError("ERR hash value is not an integer")
+		}
+		cur = n
+	}
+	cur += delta
+	item.hash[args[2]] = strconv.FormatInt(cur, 10)
+	return cur
+}
+
+//************* LIST ****************/
+
+func cmdPush(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 3 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "list", true)
+	if err != "" {
+		return err
+	}
+	for _, v := range args[2:] {
+		if strings.ToUpper(args[0]) == "LPUSH" {
+			item.list = append([]string{v}, item.list...)
+		} else {
+			item.list = append(item.list, v)
+		}
+	}
+	return int64(len(item.list))
+}
+
+func cmdPop(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "list", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return nil
+	}
+	var v string
+	if strings.ToUpper(args[0]) == "LPOP" {
+		v, item.list = item.list[0], item.list[1:]
+	} else {
+		v, item.list = item.list[len(item.list)-1], item.list[:len(item.list)-1]
+	}
+	cleanup(db, args[1], item)
+	return v
+}
+
+func cmdLLen(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "list", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	return int64(len(item.list))
+}
+
+func cmdLRange(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 4 {
+		return errArgs(args[0])
+	}
+	n, err := parseInts(args[2], args[3])
+	if err != "" {
+		return err
+	}
+	item, err := f.lookupKind(db, args[1], "list", false)
+	if err != "" {
+		return err
+	}
+	res := make([]string, 0)
+	if item == nil {
+		return res
+	}
+	start, end, ok := normalizeRange(n[0], n[1], len(item.list))
+	if !ok {
+		return res
+	}
+	return append(res, item.list[start:end]...)
+}
+
+func cmdLTrim(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 4 {
+		return errArgs(args[0])
+	}
+	n, err := parseInts(args[2], args[3])
+	if err != "" {
+		return err
+	}
+	item, err := f.lookupKind(db, args[1], "list", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return fakeStatus("OK")
+	}
+	start, end, ok := normalizeRange(n[0], n[1], len(item.list))
+	if ok {
+		item.list = append([]string{}, item.list[start:end]...)
+	} else {
+		item.list = nil
+	}
+	cleanup(db, args[1], item)
+	return fakeStatus("OK")
+}
+
+func cmdLRem(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 4 {
+		return errArgs(args[0])
+	}
+	n, err := parseInts(args[2])
+	if err != "" {
+		return err
+	}
+	item, err := f.lookupKind(db, args[1], "list", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	count, value := n[0], args[3]
+	var removed int64
+	if count >= 0 {
+		list := make([]string, 0, len(item.list))
+		for _, v := range item.list {
+			if v == value && (count == 0 || removed < int64(count)) {
+				removed++
+				continue
+			}
+			list = append(list, v)
+		}
+		item.list = list
+	} else {
+		list := make([]string, len(item.list))
+		j := len(list)
+		for i := len(item.list) - 1; i >= 0; i-- {
+			if item.list[i] == value && removed < int64(-count) {
+				removed++
+				continue
+			}
+			j--
+			list[j] = item.list[i]
+		}
+		item.list = list[j:]
+	}
+	cleanup(db, args[1], item)
+	return removed
+}
+
+func cmdLIndex(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs(args[0])
+	}
+	n, err := parseInts(args[2])
+	if err != "" {
+		return err
+	}
+	item, err := f.lookupKind(db, args[1], "list", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return nil
+	}
+	i := n[0]
+	if i < 0 {
+		i += len(item.list)
+	}
+	if i < 0 || i >= len(item.list) {
+		return nil
+	}
+	return item.list[i]
+}
+
+//************** SET ***************
+
+func cmdSAdd(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 3 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "set", true)
+	if err != "" {
+		return err
+	}
+	var n int64
+	for _, m := range args[2:] {
+		if _, ok := item.set[m]; !ok {
+			item.set[m] = struct{}{}
+			n++
+		}
+	}
+	return n
+}
+
+func cmdSRem(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 3 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "set", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	var n int64
+	for _, m := range args[2:] {
+		if _, ok := item.set[m]; ok {
+			delete(item.set, m)
+			n++
+		}
+	}
+	cleanup(db, args[1], item)
+	return n
+}
+
+func cmdSIsMember(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "set", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	_, ok := item.set[args[2]]
+	return boolInt(ok)
+}
+
+func cmdSMembers(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "set", false)
+	if err != "" {
+		return err
+	}
+	res := make([]string, 0)
+	if item == nil {
+		return res
+	}
+	for m := range item.set {
+		res = append(res, m)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func cmdSCard(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "set", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	return int64(len(item.set))
+}
+
+//************** Sorted SET ***************
+
+type zMember struct {
+	member string
+	score  float64
+}
+
+// sortedMembers 按分数升序，分数相同按成员字典序
+func sortedMembers(item *fakeItem) []zMember {
+	list := make([]zMember, 0, len(item.zset))
+	for m, s := range item.zset {
+		list = append(list, zMember{member: m, score: s})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].score != list[j].score {
+			return list[i].score < list[j].score
+		}
+		return list[i].member < list[j].member
+	})
+	return list
+}
+
+func reverseMembers(list []zMember) {
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+}
+
+func parseScore(s string) (float64, fakeError) {
+	switch strings.ToLower(s) {
+	case "+inf", "inf":
+		return math.Inf(1), ""
+	case "-inf":
+		return math.Inf(-1), ""
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fakeError("ERR value is not a valid float")
+	}
+	return v, ""
+}
+
+// scoreBound 解析 ZRANGEBYSCORE 的区间端点，支持 ( 开区间
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+func parseBound(s string) (scoreBound, fakeError) {
+	b := scoreBound{}
+	if strings.HasPrefix(s, "(") {
+		b.exclusive = true
+		s = s[1:]
+	}
+	v, err := parseScore(s)
+	if err != "" {
+		return b, fakeError("ERR min or max is not a float")
+	}
+	b.value = v
+	return b, ""
+}
+
+func inBounds(score float64, min, max scoreBound) bool {
+	if score < min.value || (min.exclusive && score == min.value) {
+		return false
+	}
+	if score > max.value || (max.exclusive && score == max.value) {
+		return false
+	}
+	return true
+}
+
+func cmdZAdd(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 4 {
+		return errArgs(args[0])
+	}
+	var nx, xx, ch bool
+	i := 2
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+			continue
+		case "XX":
+			xx = true
+			continue
+		case "CH":
+			ch = true
+			continue
+		}
+		break
+	}
+	if len(args[i:]) == 0 || len(args[i:])%2 != 0 {
+		return fakeError("ERR syntax error")
+	}
+	pairs := make([]zMember, 0, len(args[i:])/2)
+	for ; i < len(args); i += 2 {
+		score, err := parseScore(args[i])
+		if err != "" {
+			return err
+		}
+		pairs = append(pairs, zMember{member: args[i+1], score: score})
+	}
+	item, err := f.lookupKind(db, args[1], "zset", !xx)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	var added, changed int64
+	for _, p := range pairs {
+		old, ok := item.zset[p.member]
+		if (nx && ok) || (xx && !ok) {
+			continue
+		}
+		if !ok {
+			added++
+		} else if old != p.score {
+			changed++
+		}
+		item.zset[p.member] = p.score
+	}
+	cleanup(db, args[1], item)
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func cmdZIncrBy(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 4 {
+		return errArgs(args[0])
+	}
+	delta, err := parseScore(args[2])
+	if err != "" {
+		return err
+	}
+	item, err := f.lookupKind(db, args[1], "zset", true)
+	if err != "" {
+		return err
+	}
+	item.zset[args[3]] += delta
+	return formatScore(item.zset[args[3]])
+}
+
+func cmdZCard(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "zset", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	return int64(len(item.zset))
+}
+
+func cmdZCount(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 4 {
+		return errArgs(args[0])
+	}
+	min, err := parseBound(args[2])
+	if err != "" {
+		return err
+	}
+	max, err := parseBound(args[3])
+	if err != "" {
+		return err
+	}
+	item, err := f.lookupKind(db, args[1], "zset", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	var n int64
+	for _, s := range item.zset {
+		if inBounds(s, min, max) {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdZScore(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "zset", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return nil
+	}
+	if s, ok := item.zset[args[2]]; ok {
+		return formatScore(s)
+	}
+	return nil
+}
+
+func cmdZRank(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "zset", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return nil
+	}
+	list := sortedMembers(item)
+	if strings.ToUpper(args[0]) == "ZREVRANK" {
+		reverseMembers(list)
+	}
+	for i, m := range list {
+		if m.member == args[2] {
+			return int64(i)
+		}
+	}
+	return nil
+}
+
+func withScores(list []zMember, scores bool) []string {
+	res := make([]string, 0, len(list)*2)
+	for _, m := range list {
+		res = append(res, m.member)
+		if scores {
+			res = append(res, formatScore(m.score))
+		}
+	}
+	return res
+}
+
+func cmdZRange(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 4 && len(args) != 5 {
+		return errArgs(args[0])
+	}
+	scores := false
+	if len(args) == 5 {
+		if strings.ToUpper(args[4]) != "WITHSCORES" {
+			return fakeError("ERR syntax error")
+		}
+		scores = true
+	}
+	n, err := parseInts(args[2], args[3])
+	if err != "" {
+		return err
+	}
+	item, err := f.lookupKind(db, args[1], "zset", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return []string{}
+	}
+	list := sortedMembers(item)
+	if strings.ToUpper(args[0]) == "ZREVRANGE" {
+		reverseMembers(list)
+	}
+	start, end, ok := normalizeRange(n[0], n[1], len(list))
+	if !ok {
+		return []string{}
+	}
+	return withScores(list[start:end], scores)
+}
+
+func cmdZRangeByScore(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 4 {
+		return errArgs(args[0])
+	}
+	rev := strings.ToUpper(args[0]) == "ZREVRANGEBYSCORE"
+	minArg, maxArg := args[2], args[3]
+	if rev {
+		minArg, maxArg = args[3], args[2]
+	}
+	min, err := parseBound(minArg)
+	if err != "" {
+		return err
+	}
+	max, err := parseBound(maxArg)
+	if err != "" {
+		return err
+	}
+	scores := false
+	offset, count := 0, -1
+	for i := 4; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			scores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return fakeError("ERR syntax error")
+			}
+			n, err := parseInts(args[i+1], args[i+2])
+			if err != "" {
+				return err
+			}
+			offset, count = n[0], n[1]
+			i += 2
+		default:
+			return fakeError("ERR syntax error")
+		}
+	}
+	item, err := f.lookupKind(db, args[1], "zset", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return []string{}
+	}
+	list := sortedMembers(item)
+	if rev {
+		reverseMembers(list)
+	}
+	matched := make([]zMember, 0, len(list))
+	for _, m := range list {
+		if inBounds(m.score, min, max) {
+			matched = append(matched, m)
+		}
+	}
+	if offset < 0 || offset >= len(matched) {
+		return []string{}
+	}
+	matched = matched[offset:]
+	if count >= 0 && count < len(matched) {
+		matched = matched[:count]
+	}
+	return withScores(matched, scores)
+}
+
+func cmdZRem(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) < 3 {
+		return errArgs(args[0])
+	}
+	item, err := f.lookupKind(db, args[1], "zset", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	var n int64
+	for _, m := range args[2:] {
+		if _, ok := item.zset[m]; ok {
+			delete(item.zset, m)
+			n++
+		}
+	}
+	cleanup(db, args[1], item)
+	return n
+}
+
+func cmdZRemRangeByRank(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 4 {
+		return errArgs(args[0])
+	}
+	n, err := parseInts(args[2], args[3])
+	if err != "" {
+		return err
+	}
+	item, err := f.lookupKind(db, args[1], "zset", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	list := sortedMembers(item)
+	start, end, ok := normalizeRange(n[0], n[1], len(list))
+	if !ok {
+		return int64(0)
+	}
+	for _, m := range list[start:end] {
+		delete(item.zset, m.member)
+	}
+	cleanup(db, args[1], item)
+	return int64(end - start)
+}
+
+func cmdZRemRangeByScore(f *Fake, db map[string]*fakeItem, args []string) interface{} {
+	if len(args) != 4 {
+		return errArgs(args[0])
+	}
+	min, err := parseBound(args[2])
+	if err != "" {
+		return err
+	}
+	max, err := parseBound(args[3])
+	if err != "" {
+		return err
+	}
+	item, err := f.lookupKind(db, args[1], "zset", false)
+	if err != "" {
+		return err
+	}
+	if item == nil {
+		return int64(0)
+	}
+	var n int64
+	for m, s := range item.zset {
+		if inBounds(s, min, max) {
+			delete(item.zset, m)
+			n++
+		}
+	}
+	cleanup(db, args[1], item)
+	return n
+}
@@ -0,0 +1,208 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func newTestFake(t *testing.T) (*Fake, redis.Conn) {
+	t.Helper()
+	f, err := NewFake()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := f.Pool().Get()
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = f.Close()
+	})
+	return f, c
+}
+
+func TestFakeString(t *testing.T) {
+	_, c := newTestFake(t)
+	if _, err := c.Do("SET", "name", "gin"); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := redis.String(c.Do("GET", "name")); err != nil || s != "gin" {
+		t.Fatalf("GET name = %q, %v", s, err)
+	}
+	if _, err := redis.String(c.Do("GET", "missing")); err != redis.ErrNil {
+		t.Fatalf("GET missing err = %v, want ErrNil", err)
+	}
+	if n, err := redis.Int64(c.Do("INCRBY", "count", 5)); err != nil || n != 5 {
+		t.Fatalf("INCRBY count = %d, %v", n, err)
+	}
+	if ok, err := redis.Int(c.Do("SETNX", "name", "other")); err != nil || ok != 0 {
+		t.Fatalf("SETNX name = %d, %v", ok, err)
+	}
+	if n, err := redis.Int(c.Do("DEL", "name", "count")); err != nil || n != 2 {
+		t.Fatalf("DEL = %d, %v", n, err)
+	}
+	if _, err := c.Do("HSET", "h", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("GET", "h"); err == nil {
+		t.Fatal("GET on hash: want WRONGTYPE error")
+	}
+}
+
+func TestFakeHash(t *testing.T) {
+	_, c := newTestFake(t)
+	if n, err := redis.Int(c.Do("HSET", "user", "name", "gin", "age", "3")); err != nil || n != 2 {
+		t.Fatalf("HSET = %d, %v", n, err)
+	}
+	if s, err := redis.String(c.Do("HGET", "user", "name")); err != nil || s != "gin" {
+		t.Fatalf("HGET name = %q, %v", s, err)
+	}
+	if n, err := redis.Int64(c.Do("HINCRBY", "user", "age", 2)); err != nil || n != 5 {
+		t.Fatalf("HINCRBY age = %d, %v", n, err)
+	}
+	m, err := redis.StringMap(c.Do("HGETALL", "user"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"name": "gin", "age": "5"}; !reflect.DeepEqual(m, want) {
+		t.Fatalf("HGETALL = %v, want %v", m, want)
+	}
+	if _, err := c.Do("HDEL", "user", "name", "age"); err != nil {
+		t.Fatal(err)
+	}
+	//字段删完后 key 也被删除
+	if n, err := redis.Int(c.Do("EXISTS", "user")); err != nil || n != 0 {
+		t.Fatalf("EXISTS user = %d, %v", n, err)
+	}
+}
+
+func TestFakeList(t *testing.T) {
+	_, c := newTestFake(t)
+	if _, err := c.Do("RPUSH", "q", "b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := redis.Int(c.Do("LPUSH", "q", "a")); err != nil || n != 3 {
+		t.Fatalf("LPUSH = %d, %v", n, err)
+	}
+	list, err := redis.Strings(c.Do("LRANGE", "q", 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(list, want) {
+		t.Fatalf("LRANGE = %v, want %v", list, want)
+	}
+	if s, err := redis.String(c.Do("RPOP", "q")); err != nil || s != "c" {
+		t.Fatalf("RPOP = %q, %v", s, err)
+	}
+	if n, err := redis.Int(c.Do("LLEN", "q")); err != nil || n != 2 {
+		t.Fatalf("LLEN = %d, %v", n, err)
+	}
+}
+
+func TestFakeTTL(t *testing.T) {
+	f, c := newTestFake(t)
+	if _, err := c.Do("SET", "k", "v", "EX", 10); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := redis.Int(c.Do("TTL", "k")); err != nil || n != 10 {
+		t.Fatalf("TTL = %d, %v", n, err)
+	}
+	if _, err := c.Do("SET", "forever", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := redis.Int(c.Do("TTL", "forever")); err != nil || n != -1 {
+		t.Fatalf("TTL forever = %d, %v", n, err)
+	}
+	f.FastForward(11 * time.Second)
+	if _, err := redis.String(c.Do("GET", "k")); err != redis.ErrNil {
+		t.Fatalf("GET expired key err = %v, want ErrNil", err)
+	}
+	if n, err := redis.Int(c.Do("TTL", "k")); err != nil || n != -2 {
+		t.Fatalf("TTL expired = %d, %v", n, err)
+	}
+	if s, err := redis.String(c.Do("GET", "forever")); err != nil || s != "v" {
+		t.Fatalf("GET forever = %q, %v", s, err)
+	}
+}
+
+func TestFakeEval(t *testing.T) {
+	f, c := newTestFake(t)
+	const script = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+	sha := f.RegisterScript(script, func(call func(args ...interface{}) (interface{}, error), keys, argv []string) (interface{}, error) {
+		v, err := redis.String(call("GET", keys[0]))
+		if err != nil && err != redis.ErrNil {
+			return nil, err
+		}
+		if v != argv[0] {
+			return int64(0), nil
+		}
+		return call("DEL", keys[0])
+	})
+	if _, err := c.Do("SET", "lock", "token"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := redis.Int(c.Do("EVAL", script, 1, "lock", "other")); err != nil || n != 0 {
+		t.Fatalf("EVAL other = %d, %v", n, err)
+	}
+	if n, err := redis.Int(c.Do("EVALSHA", sha, 1, "lock", "token")); err != nil || n != 1 {
+		t.Fatalf("EVALSHA token = %d, %v", n, err)
+	}
+	if n, err := redis.Int(c.Do("EXISTS", "lock")); err != nil || n != 0 {
+		t.Fatalf("EXISTS lock = %d, %v", n, err)
+	}
+	if _, err := c.Do("EVAL", "return 1", 0); err == nil {
+		t.Fatal("EVAL unregistered script: want error")
+	}
+}
+
+func TestRegisterFake(t *testing.T) {
+	f, err := RegisterFake("fake_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	c, err := Lookup("fake_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Do("SET", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := redis.String(c.Do("GET", "k")); err != nil || s != "v" {
+		t.Fatalf("GET k = %q, %v", s, err)
+	}
+}
+
+func TestFakePubSub(t *testing.T) {
+	f, c := newTestFake(t)
+	sub := redis.PubSubConn{Conn: f.Pool().Get()}
+	defer sub.Close()
+	if err := sub.Subscribe("news", "sports"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"news", "sports"} {
+		s, ok := sub.Receive().(redis.Subscription)
+		if !ok || s.Kind != "subscribe" || s.Channel != want {
+			t.Fatalf("subscribe reply = %+v, want channel %s", s, want)
+		}
+	}
+	if n, err := redis.Int(c.Do("PUBLISH", "news", "hello")); err != nil || n != 1 {
+		t.Fatalf("PUBLISH = %d, %v", n, err)
+	}
+	if m, ok := sub.Receive().(redis.Message); !ok || m.Channel != "news" || string(m.Data) != "hello" {
+		t.Fatalf("message = %+v", m)
+	}
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if s, ok := sub.Receive().(redis.Subscription); !ok || s.Kind != "unsubscribe" {
+			t.Fatalf("unsubscribe reply = %+v", s)
+		}
+	}
+	if n, err := redis.Int(c.Do("PUBLISH", "news", "bye")); err != nil || n != 0 {
+		t.Fatalf("PUBLISH after unsubscribe = %d, %v", n, err)
+	}
+}
@@ -42,10 +42,20 @@ func (v *Conf) GetAddr() string {
 
 var conn = make(map[string]*redis.Pool)
 
-//Conn  获取redis可用连接
+//connMu 保护 conn，Register 可能与读取并发执行
+var connMu sync.RWMutex
+
+//getPool 获取 key 下的连接池
+func getPool(key string) *redis.Pool {
+	connMu.RLock()
+	defer connMu.RUnlock()
+	return conn[key]
+}
+
+//Conn  获取redis可用连接，配置解析失败或实例无法连通时退出进程
 func Conn(key string) *Connect {
 	_initRedis()
-	if r, ok := conn[key]; ok && r != nil {
+	if r := getPool(key); r != nil {
 		return &Connect{
 			Conn: r.Get(),
 		}
@@ -53,36 +63,80 @@ func Conn(key string) *Connect {
 	return nil
 }
 
+//Lookup 获取redis连接，配置解析失败或实例不存在时返回错误而不退出进程，用于可以降级的场景
+//实例暂时无法连通时仍返回连接，执行命令时返回错误
+func Lookup(key string) (*Connect, error) {
+	once.Do(func() {
+		initErr = initRedis()
+	})
+	if r := getPool(key); r != nil {
+		return &Connect{
+			Conn: r.Get(),
+		}, nil
+	}
+	if initErr != nil {
+		return nil, initErr
+	}
+	return nil, fmt.Errorf("redis %s not found", key)
+}
+
 //Default 获取默认实例
 func Default() *Connect {
 	return Conn("default")
 }
 
+//Register 注册连接池到 key 下，同名的配置实例将被替换，常用于测试中替换为 Fake
+func Register(key string, pool *redis.Pool) {
+	connMu.Lock()
+	defer connMu.Unlock()
+	conn[key] = pool
+}
+
+//初始化的错误
+var initErr error
+
 //_initRedis init redis config
 func _initRedis() {
 	once.Do(func() {
+		initErr = initRedis()
+	})
+	if initErr != nil {
+		log.Fatal(initErr)
+	}
+}
 
-		dbConf := config.Get("redis")
-		var data map[string]*Conf
-		if err := dbConf.Scan(&data); err != nil {
-			log.Fatal("error parsing redis configuration file ", err)
-			return
-		}
-		for k, v := range data {
-			redisPool := newRedis(v)
-			//测试是否连通
-			redisConn := redisPool.Get()
-			if err := redisPool.TestOnBorrow(redisConn, time.Now()); err != nil {
-				log.Fatal("initRedis ERROR", k, v.ToString(), err)
-			}
-			if err := redisConn.Close(); err != nil {
-				log.Error(err)
-			}
+//initRedis 按配置创建连接池，无法连通的实例也会注册，返回第一个错误
+func initRedis() error {
+	dbConf := config.Get("redis")
+	var data map[string]*Conf
+	if err := dbConf.Scan(&data); err != nil {
+		return fmt.Errorf("error parsing redis configuration file %w", err)
+	}
+	var firstErr error
+	for k, v := range data {
+		//已通过 Register 注册的实例不再覆盖
+		redisPool := newRedis(v)
+		connMu.Lock()
+		_, ok := conn[k]
+		if !ok {
 			conn[k] = redisPool
 		}
-	})
-
+		connMu.Unlock()
+		if ok {
+			continue
+		}
+		//测试是否连通
+		redisConn := redisPool.Get()
+		if err := redisPool.TestOnBorrow(redisConn, time.Now()); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("initRedis ERROR %s %s: %w", k, v.GetAddr(), err)
+		}
+		if err := redisConn.Close(); err != nil {
+			log.Error(err)
+		}
+	}
+	return firstErr
 }
+
 func newRedis(conf *Conf) *redis.Pool {
 	return &redis.Pool{
 		MaxIdle:     conf.MaxIdle,
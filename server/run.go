@@ -8,9 +8,10 @@ import (
 	"github.com/facebookgo/grace/gracehttp"
 	"github.com/582033/gin-utils/config"
 	"github.com/582033/gin-utils/log"
+	"github.com/micro/go-micro/v2/config/reader"
 	"net/http"
 	_ "net/http/pprof"
-	"time"
+	"sync"
 )
 
 //Run 运行
@@ -25,32 +26,51 @@ func (v *App) Run(addr string) {
 	}
 }
 
+//pprof 按 pprof.enable 启停 pprof 服务，端口被占用时依次尝试后续端口
 func pprof() {
-	var server *http.Server
-	var isRun bool
-	var port = 6020
-	//检测是否需要关闭
+	p := &pprofServer{}
+	if _, err := config.Watch("pprof.enable", func(_, v reader.Value) {
+		p.set(v.Bool(false))
+	}); err != nil {
+		log.Error("watch pprof.enable error ", err)
+	}
+	p.set(config.Get("pprof.enable").Bool(false))
+}
+
+type pprofServer struct {
+	sync.Mutex
+	server *http.Server
+}
+
+func (p *pprofServer) set(enable bool) {
+	p.Lock()
+	defer p.Unlock()
+	if !enable {
+		if p.server != nil {
+			_ = p.server.Shutdown(context.Background())
+			p.server = nil
+		}
+		return
+	}
+	if p.server != nil {
+		return
+	}
+	server := &http.Server{}
+	p.server = server
 	go func() {
-		for range time.Tick(3 * time.Second) {
-			if !config.Get("pprof.enable").Bool(false) && isRun && server != nil {
-				_ = server.Shutdown(context.Background())
-				isRun = false
-				port = 6020
+		for port := 6020; port < 6030; port++ {
+			server.Addr = fmt.Sprintf("0.0.0.0:%d", port)
+			log.Info("running http pprof on: ", server.Addr)
+			err := server.ListenAndServe()
+			if err == http.ErrServerClosed {
+				return
 			}
+			log.Error("running http pprof error ", err.Error())
 		}
-	}()
-
-	for range time.Tick(3 * time.Second) {
-		if config.Get("pprof.enable").Bool(false) && !isRun {
-			addr := fmt.Sprintf("0.0.0.0:%d", port)
-			log.Info("running http pprof on: ", addr)
-			server = &http.Server{Addr: addr}
-			isRun = true
-			if err := server.ListenAndServe(); err != nil {
-				isRun = false
-				log.Error("running http pprof error ", err.Error())
-			}
-			port++
+		p.Lock()
+		if p.server == server {
+			p.server = nil
 		}
-	}
+		p.Unlock()
+	}()
 }